@@ -0,0 +1,167 @@
+package traefik_real_ip
+
+import (
+	"errors"
+	"fmt"
+	"github.com/darki73/traefik-real-ip/pkg/audit"
+	"github.com/darki73/traefik-real-ip/pkg/logger"
+	"github.com/darki73/traefik-real-ip/pkg/resolver"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	_auditSinkStdout = "stdout"
+	_auditSinkFile   = "file"
+	_auditSinkSyslog = "syslog"
+)
+
+// AuditConfig holds the configuration of the audit log of requests whose real IP differs
+// from the connection peer or the incoming X-Real-Ip header. Auditing is disabled unless sink is set.
+type AuditConfig struct {
+	Sink       string `json:"sink,omitempty" toml:"sink,omitempty" yaml:"sink,omitempty"`
+	Path       string `json:"path,omitempty" toml:"path,omitempty" yaml:"path,omitempty"`
+	MaxSize    int    `json:"maxSize,omitempty" toml:"maxSize,omitempty" yaml:"maxSize,omitempty"`
+	MaxBackups int    `json:"maxBackups,omitempty" toml:"maxBackups,omitempty" yaml:"maxBackups,omitempty"`
+	Address    string `json:"address,omitempty" toml:"address,omitempty" yaml:"address,omitempty"`
+	Tag        string `json:"tag,omitempty" toml:"tag,omitempty" yaml:"tag,omitempty"`
+}
+
+// CreateAuditConfig creates the default audit configuration, with auditing disabled.
+func CreateAuditConfig() *AuditConfig {
+	return &AuditConfig{
+		Sink:       "",
+		Path:       "",
+		MaxSize:    10,
+		MaxBackups: 3,
+		Address:    "",
+		Tag:        "traefik-real-ip",
+	}
+}
+
+// checkAuditConfig returns an error if the audit configuration is not valid, without opening the sink.
+func checkAuditConfig(config *AuditConfig) error {
+	if config == nil || config.Sink == "" {
+		return nil
+	}
+
+	switch config.Sink {
+	case _auditSinkStdout:
+	case _auditSinkFile:
+		if config.Path == "" {
+			return fmt.Errorf("audit path must be set for the %s sink", _auditSinkFile)
+		}
+		if config.MaxSize < 0 || config.MaxBackups < 0 {
+			return fmt.Errorf("audit max size and max backups must not be negative")
+		}
+	case _auditSinkSyslog:
+		if _, _, err := audit.ParseSyslogTarget(config.Address); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf(
+			"audit sink %s is not valid, only the following ones are supported: %s",
+			config.Sink,
+			strings.Join([]string{_auditSinkStdout, _auditSinkFile, _auditSinkSyslog}, ", "),
+		)
+	}
+
+	return nil
+}
+
+// newAuditSink opens the audit sink of the configuration, or returns nil if auditing is disabled.
+// Sinks are shared by every middleware writing to the same file or syslog target, and kept open across
+// configuration reloads, as Traefik never closes the middlewares it replaces.
+func newAuditSink(config *AuditConfig) (*audit.AsyncSink, error) {
+	if err := checkAuditConfig(config); err != nil {
+		return nil, err
+	}
+
+	if config == nil || config.Sink == "" {
+		return nil, nil
+	}
+
+	defaults := CreateAuditConfig()
+
+	switch config.Sink {
+	case _auditSinkFile:
+		maxSize := config.MaxSize
+		if maxSize == 0 {
+			maxSize = defaults.MaxSize
+		}
+
+		maxBackups := config.MaxBackups
+		if maxBackups == 0 {
+			maxBackups = defaults.MaxBackups
+		}
+
+		return audit.OpenFile(config.Path, int64(maxSize)*1024*1024, maxBackups)
+	case _auditSinkSyslog:
+		tag := config.Tag
+		if tag == "" {
+			tag = defaults.Tag
+		}
+
+		return audit.OpenSyslog(config.Address, tag)
+	default:
+		return audit.OpenWriter(_auditSinkStdout, os.Stdout), nil
+	}
+}
+
+// logAuditError logs the error of a background write of the audit sink, along with the target of the sink,
+// as the event may have been written on behalf of another middleware sharing it.
+func (trip *TraefikRealIP) logAuditError(err error) {
+	trip.logger.Log(
+		logger.LevelError,
+		"unable to write audit event",
+		logger.Field{Key: "name", Value: trip.name},
+		logger.Field{Key: "sink", Value: trip.auditSink.Target()},
+		logger.Field{Key: "error", Value: err.Error()},
+	)
+}
+
+// auditResolution records the request if its real IP differs from the connection peer or the incoming X-Real-Ip header.
+// It must be called before the headers of the request are replaced.
+func (trip *TraefikRealIP) auditResolution(request *http.Request, res *resolution) {
+	realIP := res.realIP()
+	if trip.auditSink == nil || !realIP.IsValid() {
+		return
+	}
+
+	var changes []string
+
+	if peer := resolver.ParsePeerIP(request.RemoteAddr); peer != realIP {
+		changes = append(changes, audit.ChangePeer)
+	}
+
+	incoming := request.Header.Get("X-Real-Ip")
+	if incoming != "" && resolver.ParsePeerIP(incoming) != realIP {
+		changes = append(changes, audit.ChangeRealIP)
+	}
+
+	if len(changes) == 0 {
+		return
+	}
+
+	// Events are written in the background, the only error left is a full buffer, which is counted instead of logged
+	// so a slow sink does not flood the log.
+	err := trip.auditSink.Write(audit.Event{
+		Time:           time.Now(),
+		Name:           trip.name,
+		Host:           request.Host,
+		Path:           request.URL.Path,
+		Peer:           request.RemoteAddr,
+		IncomingRealIP: incoming,
+		IP:             realIP.String(),
+		Provider:       res.realIPProvider(),
+		Header:         res.realIPHeader(),
+		Changes:        changes,
+	})
+	if errors.Is(err, audit.ErrDropped) {
+		trip.metrics.observeAuditDropped()
+	} else if err != nil {
+		trip.logAuditError(err)
+	}
+}
@@ -0,0 +1,193 @@
+package traefik_real_ip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// benchmarkScenario describes a request served by a middleware created from the configuration.
+// The budget is the maximum number of allocations a single ServeHTTP call is allowed to make,
+// including the X-Forwarded-For and X-Real-Ip headers set for the next handler.
+type benchmarkScenario struct {
+	description string
+	config      *Config
+	headers     map[string]string
+	budget      float64
+}
+
+// benchmarkScenarios returns the scenarios shared by the benchmarks and the allocation budget test.
+func benchmarkScenarios() []benchmarkScenario {
+	longChain := make([]string, 0, 64)
+	for index := 0; index < 63; index++ {
+		longChain = append(longChain, fmt.Sprintf("10.0.%d.%d", index/256, index%256))
+	}
+	longChain = append(longChain, "8.8.8.8")
+
+	largeExclusions := make([]string, 0, 10000)
+	for index := 0; index < 10000; index++ {
+		largeExclusions = append(largeExclusions, fmt.Sprintf("44.%d.%d.0/24", index/256, index%256))
+	}
+
+	return []benchmarkScenario{
+		{
+			description: "generic X-Real-Ip",
+			config:      &Config{},
+			headers:     map[string]string{"X-Real-Ip": "8.8.8.8"},
+			budget:      8,
+		},
+		{
+			description: "generic X-Forwarded-For",
+			config:      &Config{ExcludedNetworks: []string{"private"}},
+			headers:     map[string]string{"X-Forwarded-For": "10.0.0.1, 172.16.0.1, 8.8.8.8"},
+			budget:      10,
+		},
+		{
+			description: "generic long X-Forwarded-For",
+			config:      &Config{ExcludedNetworks: []string{"private"}},
+			headers:     map[string]string{"X-Forwarded-For": strings.Join(longChain, ", ")},
+			budget:      15,
+		},
+		{
+			description: "generic IPv6",
+			config:      &Config{ExcludedNetworks: []string{"private", "linklocal"}},
+			headers:     map[string]string{"X-Forwarded-For": "fd00::1, fe80::1, 2001:4860:4860::8888"},
+			budget:      10,
+		},
+		{
+			description: "generic excluded addresses and IPv4-mapped",
+			config: &Config{
+				ExcludedNetworks:  []string{"private"},
+				ExcludedAddresses: []string{"127.0.0.1", "::1"},
+			},
+			headers: map[string]string{"X-Forwarded-For": "10.0.0.1, 127.0.0.1, ::ffff:8.8.8.8, 10.0.0.2"},
+			budget:  10,
+		},
+		{
+			description: "cloudflare",
+			config:      &Config{PreferredProvider: "cloudflare"},
+			headers:     map[string]string{"CF-Connecting-IP": "8.8.8.8", "X-Forwarded-For": "8.8.8.8, 172.68.0.1"},
+			budget:      11,
+		},
+		{
+			description: "qrator",
+			config:      &Config{PreferredProvider: "qrator"},
+			headers:     map[string]string{"X-Qrator-IP-Source": "8.8.8.8", "X-Forwarded-For": "8.8.8.8, 178.248.232.1"},
+			budget:      11,
+		},
+		{
+			description: "large exclusion list",
+			config:      &Config{ExcludedNetworks: largeExclusions},
+			headers:     map[string]string{"X-Forwarded-For": "44.0.1.1, 44.10.3.1, 44.39.15.1, 8.8.8.8"},
+			budget:      11,
+		},
+		{
+			description: "cache",
+			config:      &Config{ExcludedNetworks: []string{"private"}, Cache: &CacheConfig{MaxEntries: 1000}},
+			headers:     map[string]string{"X-Forwarded-For": "10.0.0.1, 172.16.0.1, 8.8.8.8"},
+			budget:      6,
+		},
+	}
+}
+
+// newBenchmarkRequest creates the middleware and the request of the scenario.
+// The next handler restores the headers of the request, so it can be served repeatedly.
+func newBenchmarkRequest(framework testing.TB, scenario benchmarkScenario) (http.Handler, *http.Request) {
+	framework.Helper()
+
+	request := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	for key, value := range scenario.headers {
+		request.Header.Set(key, value)
+	}
+
+	forwardedFor := request.Header.Values("X-Forwarded-For")
+	realIP := request.Header.Values("X-Real-Ip")
+
+	next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		restoreHeader(request.Header, "X-Forwarded-For", forwardedFor)
+		restoreHeader(request.Header, "X-Real-Ip", realIP)
+	})
+
+	trip, err := New(context.Background(), next, scenario.config, "traefik-real-ip")
+	require.NoError(framework, err)
+
+	return trip, request
+}
+
+// restoreHeader sets the header back to the original lines, without allocating.
+func restoreHeader(header http.Header, key string, lines []string) {
+	if lines == nil {
+		header.Del(key)
+		return
+	}
+
+	header[key] = lines
+}
+
+func TestAllocationBudget(framework *testing.T) {
+	if testing.Short() {
+		framework.Skip("allocation budget is not checked in short mode")
+	}
+
+	for _, scenario := range benchmarkScenarios() {
+		scenario := scenario
+		framework.Run(scenario.description, func(framework *testing.T) {
+			trip, request := newBenchmarkRequest(framework, scenario)
+			recorder := httptest.NewRecorder()
+
+			allocations := testing.AllocsPerRun(100, func() {
+				trip.ServeHTTP(recorder, request)
+			})
+
+			if allocations > scenario.budget {
+				framework.Errorf("ServeHTTP made %.0f allocations, the budget is %.0f", allocations, scenario.budget)
+			}
+		})
+	}
+}
+
+func BenchmarkServeHTTP(benchmark *testing.B) {
+	for _, scenario := range benchmarkScenarios() {
+		scenario := scenario
+		benchmark.Run(scenario.description, func(benchmark *testing.B) {
+			trip, request := newBenchmarkRequest(benchmark, scenario)
+			recorder := httptest.NewRecorder()
+
+			benchmark.ReportAllocs()
+			benchmark.ResetTimer()
+
+			for index := 0; index < benchmark.N; index++ {
+				trip.ServeHTTP(recorder, request)
+			}
+		})
+	}
+}
+
+func BenchmarkServeHTTPParallel(benchmark *testing.B) {
+	for _, scenario := range benchmarkScenarios() {
+		scenario := scenario
+		benchmark.Run(scenario.description, func(benchmark *testing.B) {
+			trip, _ := newBenchmarkRequest(benchmark, scenario)
+
+			benchmark.ReportAllocs()
+			benchmark.ResetTimer()
+
+			benchmark.RunParallel(func(parallel *testing.PB) {
+				request := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+				recorder := httptest.NewRecorder()
+
+				for parallel.Next() {
+					for key, value := range scenario.headers {
+						request.Header.Set(key, value)
+					}
+					trip.ServeHTTP(recorder, request)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package traefik_real_ip
+
+import (
+	"github.com/darki73/traefik-real-ip/pkg/cidr"
+	"github.com/darki73/traefik-real-ip/pkg/networks"
+)
+
+// BogonFilterConfig holds the categories of addresses which are never accepted as the real IP.
+// Every category is filtered unless it is set to false, so categories left out of the configuration stay filtered.
+type BogonFilterConfig struct {
+	Unspecified   *bool `json:"unspecified,omitempty" toml:"unspecified,omitempty" yaml:"unspecified,omitempty"`
+	Broadcast     *bool `json:"broadcast,omitempty" toml:"broadcast,omitempty" yaml:"broadcast,omitempty"`
+	Multicast     *bool `json:"multicast,omitempty" toml:"multicast,omitempty" yaml:"multicast,omitempty"`
+	Documentation *bool `json:"documentation,omitempty" toml:"documentation,omitempty" yaml:"documentation,omitempty"`
+	Reserved      *bool `json:"reserved,omitempty" toml:"reserved,omitempty" yaml:"reserved,omitempty"`
+}
+
+// CreateBogonFilterConfig creates the default bogon filter configuration, with every category enabled.
+func CreateBogonFilterConfig() *BogonFilterConfig {
+	return &BogonFilterConfig{
+		Unspecified:   newBool(true),
+		Broadcast:     newBool(true),
+		Multicast:     newBool(true),
+		Documentation: newBool(true),
+		Reserved:      newBool(true),
+	}
+}
+
+// newBogonMatcher creates the matcher of the enabled bogon categories.
+// When no configuration is passed, every category is enabled.
+func newBogonMatcher(config *BogonFilterConfig) *cidr.Matcher {
+	if config == nil {
+		config = CreateBogonFilterConfig()
+	}
+
+	categories := map[string]*bool{
+		"unspecified":   config.Unspecified,
+		"broadcast":     config.Broadcast,
+		"multicast":     config.Multicast,
+		"documentation": config.Documentation,
+		"reserved":      config.Reserved,
+	}
+
+	matcher := cidr.NewMatcher()
+	for category, enabled := range categories {
+		if enabled != nil && !*enabled {
+			continue
+		}
+		prefixes, _ := networks.Lookup(category)
+		matcher.InsertAll(prefixes, "bogonFilter:"+category)
+	}
+
+	return matcher
+}
+
+// newBool returns a pointer to a new bool holding the value, so default configurations never share it.
+func newBool(value bool) *bool {
+	return &value
+}
@@ -0,0 +1,136 @@
+package traefik_real_ip
+
+import (
+	"fmt"
+	"github.com/darki73/traefik-real-ip/pkg/lru"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// CacheConfig holds the configuration of the resolution cache.
+// Caching is disabled unless max entries is set.
+type CacheConfig struct {
+	MaxEntries int `json:"maxEntries,omitempty" toml:"maxEntries,omitempty" yaml:"maxEntries,omitempty"`
+}
+
+// CreateCacheConfig creates the default cache configuration, with caching disabled.
+func CreateCacheConfig() *CacheConfig {
+	return &CacheConfig{
+		MaxEntries: 0,
+	}
+}
+
+// CacheStats holds the counters of the resolution cache.
+type CacheStats struct {
+	// Hits is the number of requests resolved from the cache.
+	Hits uint64
+	// Misses is the number of requests which had to be resolved by the providers.
+	Misses uint64
+	// Entries is the number of resolutions currently cached.
+	Entries int
+}
+
+// resolutionCache holds the resolutions of recently seen combinations of connection peer and provider headers.
+type resolutionCache struct {
+	headers []string // canonical keys of the provider headers
+	entries *lru.Cache
+	hits    uint64
+	misses  uint64
+	mutex   sync.Mutex
+}
+
+// newResolutionCache creates the resolution cache keyed by the given headers, or returns nil if caching is disabled.
+func newResolutionCache(config *CacheConfig, headers []string) (*resolutionCache, error) {
+	if config == nil || config.MaxEntries == 0 {
+		return nil, nil
+	}
+
+	if config.MaxEntries < 0 {
+		return nil, fmt.Errorf("cache max entries %d is not valid, it must not be negative", config.MaxEntries)
+	}
+
+	keys := make([]string, 0, len(headers))
+	for _, header := range headers {
+		keys = append(keys, http.CanonicalHeaderKey(header))
+	}
+
+	return &resolutionCache{
+		headers: keys,
+		entries: lru.New(config.MaxEntries),
+	}, nil
+}
+
+// key returns the cache key of the request, made of the connection peer address and every line of the provider headers.
+func (cache *resolutionCache) key(request *http.Request) string {
+	var builder strings.Builder
+	builder.WriteString(request.RemoteAddr)
+
+	for _, header := range cache.headers {
+		for _, line := range request.Header[header] {
+			builder.WriteByte('\n')
+			builder.WriteString(header)
+			builder.WriteByte(':')
+			builder.WriteString(line)
+		}
+	}
+
+	return builder.String()
+}
+
+// get returns the cached resolution of the key, counting the hit or miss.
+func (cache *resolutionCache) get(key string) (*resolution, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	value, ok := cache.entries.Get(key)
+	if !ok {
+		cache.misses++
+		return nil, false
+	}
+
+	cache.hits++
+
+	return value.(*resolution), true
+}
+
+// add stores the resolution under the key.
+func (cache *resolutionCache) add(key string, res *resolution) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.entries.Add(key, res)
+}
+
+// stats returns the current counters of the cache.
+func (cache *resolutionCache) stats() CacheStats {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return CacheStats{
+		Hits:    cache.hits,
+		Misses:  cache.misses,
+		Entries: cache.entries.Len(),
+	}
+}
+
+// GetCacheStats returns the counters of the resolution cache, all zero if caching is disabled.
+func (trip *TraefikRealIP) GetCacheStats() CacheStats {
+	if trip.cache == nil {
+		return CacheStats{}
+	}
+
+	return trip.cache.stats()
+}
+
+// getCacheHeaders returns the headers of every provider, whether or not it is preferred.
+// Untrusted peers have every provider consulted and the spoofing rules read the headers of every CDN provider,
+// so leaving any of them out of the key would let a request reuse the resolution of one without the header.
+func (trip *TraefikRealIP) getCacheHeaders() []string {
+	var headers []string
+
+	headers = append(headers, trip.resolver.Cloudflare().GetHeaders()...)
+	headers = append(headers, trip.resolver.Qrator().GetHeaders()...)
+
+	return append(headers, trip.resolver.Generic().GetHeaders()...)
+}
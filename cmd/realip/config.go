@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	traefik_real_ip "github.com/darki73/traefik-real-ip"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	_formatYAML = "yaml"
+	_formatTOML = "toml"
+	_formatJSON = "json"
+)
+
+// loadConfig reads the plugin configuration from the file.
+// The file holds either the plugin configuration itself, or a Traefik dynamic configuration
+// in which case the configuration of the middleware is used (the only one, unless middleware is set).
+// It returns the configuration and the name of the middleware.
+func loadConfig(path string, format string, middleware string) (*traefik_real_ip.Config, string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if format == "" {
+		format = detectFormat(path)
+	}
+
+	document, err := decodeDocument(content, format)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	name := middleware
+	if _, ok := document["http"]; ok {
+		document, name, err = findPluginConfig(document, middleware)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to find the plugin configuration in %s: %w", path, err)
+		}
+	}
+
+	config, err := decodeConfig(document)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode the plugin configuration in %s: %w", path, err)
+	}
+
+	return config, name, nil
+}
+
+// detectFormat returns the format of the file from its extension, defaulting to YAML.
+func detectFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return _formatTOML
+	case ".json":
+		return _formatJSON
+	default:
+		return _formatYAML
+	}
+}
+
+// decodeDocument decodes the content in the format into a generic document.
+func decodeDocument(content []byte, format string) (map[string]interface{}, error) {
+	document := make(map[string]interface{})
+
+	switch format {
+	case _formatYAML:
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			return nil, err
+		}
+	case _formatTOML:
+		if err := toml.Unmarshal(content, &document); err != nil {
+			return nil, err
+		}
+	case _formatJSON:
+		if err := json.Unmarshal(content, &document); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf(
+			"format %s is not valid, only the following ones are supported: %s",
+			format,
+			strings.Join([]string{_formatYAML, _formatTOML, _formatJSON}, ", "),
+		)
+	}
+
+	if document == nil {
+		document = make(map[string]interface{})
+	}
+
+	return document, nil
+}
+
+// findPluginConfig returns the plugin configuration of the middleware from a Traefik dynamic configuration.
+func findPluginConfig(document map[string]interface{}, middleware string) (map[string]interface{}, string, error) {
+	middlewares, ok := lookupTable(document, "http", "middlewares")
+	if !ok {
+		return nil, "", fmt.Errorf("http.middlewares is not set")
+	}
+
+	candidates := make(map[string]map[string]interface{})
+	for name := range middlewares {
+		plugin, ok := lookupTable(middlewares, name, "plugin")
+		if !ok || len(plugin) != 1 {
+			continue
+		}
+		for _, value := range plugin {
+			if config, ok := toTable(value); ok {
+				candidates[name] = config
+			}
+		}
+	}
+
+	if middleware != "" {
+		config, ok := candidates[middleware]
+		if !ok {
+			return nil, "", fmt.Errorf("middleware %s is not a plugin middleware", middleware)
+		}
+		return config, middleware, nil
+	}
+
+	if len(candidates) != 1 {
+		names := make([]string, 0, len(candidates))
+		for name := range candidates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return nil, "", fmt.Errorf("found %d plugin middlewares (%s), select one with -middleware", len(names), strings.Join(names, ", "))
+	}
+
+	for name, config := range candidates {
+		return config, name, nil
+	}
+
+	return nil, "", nil
+}
+
+// lookupTable walks the nested tables along the keys.
+func lookupTable(table map[string]interface{}, keys ...string) (map[string]interface{}, bool) {
+	for _, key := range keys {
+		next, ok := toTable(table[key])
+		if !ok {
+			return nil, false
+		}
+		table = next
+	}
+
+	return table, true
+}
+
+// toTable returns the value as a table, if it is one.
+func toTable(value interface{}) (map[string]interface{}, bool) {
+	table, ok := value.(map[string]interface{})
+	if !ok || table == nil {
+		return nil, false
+	}
+
+	return table, true
+}
+
+// decodeConfig decodes the generic document into the plugin configuration, refusing unknown options.
+// Options are matched case-insensitively, as Traefik does.
+func decodeConfig(document map[string]interface{}) (*traefik_real_ip.Config, error) {
+	content, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	config := traefik_real_ip.CreateConfig()
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	traefik_real_ip "github.com/darki73/traefik-real-ip"
+	"io"
+	"strings"
+)
+
+// _exitLintFailure is the exit code when a lint warning reaches the -fail-on severity.
+const _exitLintFailure = 3
+
+// lintReport holds the validation errors and the lint warnings of a configuration.
+type lintReport struct {
+	Errors   traefik_real_ip.ValidationErrors `json:"errors"`
+	Warnings []traefik_real_ip.LintWarning    `json:"warnings"`
+}
+
+// runLint validates and lints a configuration.
+func runLint(arguments []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("realip lint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	configPath := flags.String("config", "", "path to the plugin configuration or a Traefik dynamic configuration (required)")
+	format := flags.String("format", "", "format of the configuration: yaml, toml or json (default is detected from the extension)")
+	middleware := flags.String("middleware", "", "name of the middleware in a Traefik dynamic configuration (default is the only plugin middleware)")
+	failOn := flags.String("fail-on", traefik_real_ip.LintSeverityCritical, "lowest severity which makes the command fail: info, warning, critical or none")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+
+	if err := flags.Parse(arguments); err != nil {
+		return 2
+	}
+
+	if *configPath == "" {
+		fmt.Fprintln(stderr, "realip: -config is required")
+		flags.Usage()
+		return 2
+	}
+
+	switch *failOn {
+	case traefik_real_ip.LintSeverityInfo, traefik_real_ip.LintSeverityWarning, traefik_real_ip.LintSeverityCritical, "none":
+	default:
+		fmt.Fprintf(stderr, "realip: -fail-on %s is not valid, only the following ones are supported: info, warning, critical, none\n", *failOn)
+		return 2
+	}
+
+	config, _, err := loadConfig(*configPath, *format, *middleware)
+	if err != nil {
+		fmt.Fprintf(stderr, "realip: %s\n", err)
+		return 1
+	}
+
+	report := &lintReport{
+		Errors:   traefik_real_ip.ValidationErrors{},
+		Warnings: config.Lint(),
+	}
+	if report.Warnings == nil {
+		report.Warnings = []traefik_real_ip.LintWarning{}
+	}
+
+	if err := config.Validate(); err != nil {
+		if !errors.As(err, &report.Errors) {
+			fmt.Fprintf(stderr, "realip: %s\n", err)
+			return 1
+		}
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(report)
+	} else {
+		printLintReport(stdout, report)
+	}
+
+	if len(report.Errors) > 0 {
+		return 1
+	}
+
+	if *failOn != "none" {
+		for _, warning := range report.Warnings {
+			if traefik_real_ip.IsLintSeverityAtLeast(warning.Severity, *failOn) {
+				return _exitLintFailure
+			}
+		}
+	}
+
+	return 0
+}
+
+// printLintReport prints the report in a human readable form.
+func printLintReport(writer io.Writer, report *lintReport) {
+	if len(report.Errors) == 0 && len(report.Warnings) == 0 {
+		fmt.Fprintln(writer, "no problems found")
+		return
+	}
+
+	for _, err := range report.Errors {
+		fmt.Fprintf(writer, "%-9s %s: %s\n", "error", err.Field, err.Message)
+	}
+
+	indent := strings.Repeat(" ", 10)
+	for _, warning := range report.Warnings {
+		fmt.Fprintf(writer, "%-9s %s: %s [%s]\n", warning.Severity, warning.Field, warning.Message, warning.Rule)
+		fmt.Fprintf(writer, "%sfix: %s\n", indent, warning.Remediation)
+	}
+}
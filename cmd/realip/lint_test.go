@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(framework *testing.T) {
+	framework.Parallel()
+
+	clean := writeFile(framework, "clean.yml", `
+trustedNetworks: ["private"]
+strict: true
+`)
+	warned := writeFile(framework, "warned.yml", `
+excludedNetworks: ["private"]
+`)
+	critical := writeFile(framework, "critical.toml", `
+excludedNetworks = ["0.0.0.0/0"]
+trustedNetworks = ["private"]
+strict = true
+`)
+	invalid := writeFile(framework, "invalid.json", `{"excludedNetworks": ["invalid"], "trustedNetworks": ["private"], "strict": true}`)
+
+	testCases := []struct {
+		description    string
+		arguments      []string
+		expectedCode   int
+		expectedOutput []string
+	}{
+		{
+			description:    "Clean configuration should have no problem",
+			arguments:      []string{"-config", clean},
+			expectedCode:   0,
+			expectedOutput: []string{"no problems found"},
+		},
+		{
+			description:  "Warnings should not fail by default",
+			arguments:    []string{"-config", warned},
+			expectedCode: 0,
+			expectedOutput: []string{
+				"warning   trustedNetworks: X-Forwarded-For is read from the left",
+				"fix: list your proxies in trustedNetworks",
+			},
+		},
+		{
+			description:  "Warnings should fail with a lower threshold",
+			arguments:    []string{"-config", warned, "-fail-on", "warning"},
+			expectedCode: _exitLintFailure,
+		},
+		{
+			description:  "Critical warnings should fail by default",
+			arguments:    []string{"-config", critical},
+			expectedCode: _exitLintFailure,
+			expectedOutput: []string{
+				"critical  excludedNetworks[0]: network 0.0.0.0/0 excludes every address of its family",
+			},
+		},
+		{
+			description:  "Critical warnings should not fail when disabled",
+			arguments:    []string{"-config", critical, "-fail-on", "none"},
+			expectedCode: 0,
+		},
+		{
+			description:  "Validation errors should be reported and fail",
+			arguments:    []string{"-config", invalid},
+			expectedCode: 1,
+			expectedOutput: []string{
+				"error     excludedNetworks[0]: network invalid is neither in CIDR notation",
+			},
+		},
+		{
+			description:  "Unknown threshold should be a usage error",
+			arguments:    []string{"-config", clean, "-fail-on", "fatal"},
+			expectedCode: 2,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+
+			code := run(append([]string{"lint"}, test.arguments...), stdout, stderr)
+
+			assert.Equal(framework, test.expectedCode, code, stderr.String())
+			for _, line := range test.expectedOutput {
+				assert.Contains(framework, stdout.String(), line)
+			}
+		})
+	}
+
+	framework.Run("Report should be printed as JSON", func(framework *testing.T) {
+		framework.Parallel()
+
+		stdout := &bytes.Buffer{}
+		code := run([]string{"lint", "-config", invalid, "-json"}, stdout, &bytes.Buffer{})
+		require.Equal(framework, 1, code)
+
+		report := &lintReport{}
+		require.NoError(framework, json.Unmarshal(stdout.Bytes(), report))
+		require.Len(framework, report.Errors, 1)
+		assert.Equal(framework, "excludedNetworks[0]", report.Errors[0].Field)
+		assert.Empty(framework, report.Warnings)
+	})
+}
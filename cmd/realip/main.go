@@ -0,0 +1,243 @@
+// Command realip resolves the real IP of captured requests with a plugin configuration, offline.
+//
+// Usage:
+//
+//	realip -config dynamic.yml -request request.txt -remote-addr 10.0.0.1:51234
+//	realip -config plugin.toml -header "X-Forwarded-For: 10.0.0.2, 203.0.113.7"
+//	realip replay -before current.yml -after proposed.yml access.log
+//	realip lint -config dynamic.yml
+//
+// The configuration is read as Traefik would pass it to the plugin, either alone or within a dynamic configuration.
+// Requests are passed through New and ServeHTTP in explain mode, and the explanation is printed.
+// The replay subcommand runs Traefik JSON access logs through two configurations and reports the differences.
+// The lint subcommand reports the validation errors and the likely mistakes of a configuration.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	traefik_real_ip "github.com/darki73/traefik-real-ip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+)
+
+// _explainHeader is the header carrying the secret of the explain mode enabled by the command.
+const _explainHeader = "X-Real-IP-Cli-Explain"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command with the arguments and returns its exit code.
+func run(arguments []string, stdout io.Writer, stderr io.Writer) int {
+	if len(arguments) > 0 {
+		switch arguments[0] {
+		case "replay":
+			return runReplay(arguments[1:], stdout, stderr)
+		case "lint":
+			return runLint(arguments[1:], stdout, stderr)
+		}
+	}
+
+	return runResolve(arguments, stdout, stderr)
+}
+
+// runResolve explains the resolution of a single request.
+func runResolve(arguments []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("realip", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	var headers headerFlags
+	configPath := flags.String("config", "", "path to the plugin configuration or a Traefik dynamic configuration (required)")
+	format := flags.String("format", "", "format of the configuration: yaml, toml or json (default is detected from the extension)")
+	middleware := flags.String("middleware", "", "name of the middleware in a Traefik dynamic configuration (default is the only plugin middleware)")
+	requestPath := flags.String("request", "", "path to a raw HTTP request, - for the standard input")
+	remoteAddr := flags.String("remote-addr", "192.0.2.1:1234", "address of the connection peer")
+	asJSON := flags.Bool("json", false, "print the explanation as JSON")
+	flags.Var(&headers, "header", "header of the request in the \"Name: value\" form, may be repeated")
+
+	if err := flags.Parse(arguments); err != nil {
+		return 2
+	}
+
+	if *configPath == "" {
+		fmt.Fprintln(stderr, "realip: -config is required")
+		flags.Usage()
+		return 2
+	}
+
+	config, name, err := loadConfig(*configPath, *format, *middleware)
+	if err != nil {
+		fmt.Fprintf(stderr, "realip: %s\n", err)
+		return 1
+	}
+
+	request, err := loadRequest(*requestPath, headers, *remoteAddr)
+	if err != nil {
+		fmt.Fprintf(stderr, "realip: %s\n", err)
+		return 1
+	}
+
+	if name == "" {
+		name = "realip"
+	}
+
+	explainer, err := newExplainer(config, name)
+	if err != nil {
+		fmt.Fprintf(stderr, "realip: %s\n", err)
+		return 1
+	}
+
+	explanation, err := explainer.explain(request)
+	if err != nil {
+		fmt.Fprintf(stderr, "realip: %s\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(explanation)
+		return 0
+	}
+
+	printExplanation(stdout, explanation)
+	return 0
+}
+
+// explainer answers requests with their explanation, through the middleware in explain mode.
+type explainer struct {
+	handler http.Handler
+	secret  string
+}
+
+// newExplainer creates the middleware from the configuration with explain mode enabled.
+// Audit and metrics are disabled and logs are written to the standard error, so that nothing outside
+// of the command is affected and the standard output only holds the explanations.
+func newExplainer(config *traefik_real_ip.Config, name string) (*explainer, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	config.Explain = &traefik_real_ip.ExplainConfig{Header: _explainHeader, Secret: secret}
+	config.Audit = nil
+	config.Metrics = nil
+	if config.Logging == nil {
+		config.Logging = traefik_real_ip.CreateLoggingConfig()
+	}
+	config.Logging.Output = "stderr"
+
+	next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+	handler, err := traefik_real_ip.New(context.Background(), next, config, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &explainer{handler: handler, secret: secret}, nil
+}
+
+// explain returns the explanation of the request.
+func (explainer *explainer) explain(request *http.Request) (*traefik_real_ip.Explanation, error) {
+	request.Header.Set(_explainHeader, explainer.secret)
+	defer request.Header.Del(_explainHeader)
+
+	recorder := httptest.NewRecorder()
+	explainer.handler.ServeHTTP(recorder, request)
+
+	explanation := &traefik_real_ip.Explanation{}
+	if err := json.NewDecoder(recorder.Body).Decode(explanation); err != nil {
+		return nil, fmt.Errorf("failed to decode the explanation: %w", err)
+	}
+
+	return explanation, nil
+}
+
+// newSecret returns a random secret for the explain mode.
+func newSecret() (string, error) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// printExplanation prints the explanation in a human readable form.
+func printExplanation(writer io.Writer, explanation *traefik_real_ip.Explanation) {
+	if explanation.Result != nil {
+		fmt.Fprintf(writer, "real ip:  %s (provider %s, header %s)\n", explanation.Result.IP, explanation.Result.Provider, explanation.Result.Header)
+	} else if !explanation.Peer.Trusted {
+		fmt.Fprintln(writer, "real ip:  not resolved, forwarding headers of untrusted peers are ignored")
+	} else {
+		fmt.Fprintln(writer, "real ip:  not resolved")
+	}
+
+	trust := "untrusted"
+	if explanation.Peer.Trusted {
+		trust = "trusted"
+	}
+	fmt.Fprintf(writer, "peer:     %s (%s)\n", explanation.Peer.Address, trust)
+
+	if explanation.Verdict.Rejected != "" {
+		fmt.Fprintf(writer, "verdict:  rejected (%s) with status %d\n", explanation.Verdict.Rejected, explanation.Verdict.Status)
+	} else {
+		fmt.Fprintf(writer, "verdict:  forwarded with status %d\n", explanation.Verdict.Status)
+	}
+
+	for _, provider := range explanation.Providers {
+		outcome := "not resolved"
+		if provider.Resolved {
+			outcome = "resolved"
+		}
+		fmt.Fprintf(writer, "\nprovider %s: %s\n", provider.Provider, outcome)
+
+		for _, header := range sortedKeys(provider.Values) {
+			fmt.Fprintf(writer, "  %s: %s\n", header, provider.Values[header])
+		}
+		for _, rejection := range provider.Rejected {
+			fmt.Fprintf(writer, "  rejected %q from %s: %s", rejection.Value, rejection.Header, rejection.Reason)
+			if rejection.Label != "" {
+				fmt.Fprintf(writer, " by %s", rejection.Label)
+			}
+			if rejection.Network != "" {
+				fmt.Fprintf(writer, " (%s)", rejection.Network)
+			}
+			if rejection.Error != "" {
+				fmt.Fprintf(writer, " (%s)", rejection.Error)
+			}
+			fmt.Fprintln(writer)
+		}
+		for _, violation := range provider.Exceeded {
+			fmt.Fprintf(writer, "  exceeded %s limit of %s\n", violation.Limit, violation.Header)
+		}
+		for _, header := range provider.Duplicated {
+			fmt.Fprintf(writer, "  duplicated %s\n", header)
+		}
+	}
+
+	if len(explanation.Verdict.Forwarded) > 0 {
+		fmt.Fprintln(writer, "\nforwarded headers:")
+		for _, header := range sortedKeys(explanation.Verdict.Forwarded) {
+			fmt.Fprintf(writer, "  %s: %s\n", header, explanation.Verdict.Forwarded[header])
+		}
+	}
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
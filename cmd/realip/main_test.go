@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	traefik_real_ip "github.com/darki73/traefik-real-ip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(framework *testing.T, name string, content string) string {
+	path := filepath.Join(framework.TempDir(), name)
+	require.NoError(framework, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestLoadConfig(framework *testing.T) {
+	framework.Parallel()
+
+	testCases := []struct {
+		description  string
+		file         string
+		content      string
+		middleware   string
+		expectedName string
+		expectedErr  string
+	}{
+		{
+			description: "YAML plugin configuration should be loaded",
+			file:        "plugin.yml",
+			content: `
+excludedNetworks: ["10.0.0.0/8"]
+preferredProvider: cloudflare
+strictStatusCode: 403
+`,
+		},
+		{
+			description: "TOML plugin configuration should be loaded",
+			file:        "plugin.toml",
+			content: `
+excludedNetworks = ["10.0.0.0/8"] # private
+preferredProvider = 'cloudflare'
+strictStatusCode = 403
+`,
+		},
+		{
+			description: "JSON plugin configuration should be loaded",
+			file:        "plugin.json",
+			content:     `{"excludedNetworks": ["10.0.0.0/8"], "preferredProvider": "cloudflare", "strictStatusCode": 403}`,
+		},
+		{
+			description: "YAML dynamic configuration should be searched for the plugin middleware",
+			file:        "dynamic.yml",
+			content: `
+http:
+  middlewares:
+    compress:
+      compress: {}
+    real-ip:
+      plugin:
+        traefik-real-ip:
+          excludedNetworks: ["10.0.0.0/8"]
+          preferredProvider: cloudflare
+          strictStatusCode: 403
+`,
+			expectedName: "real-ip",
+		},
+		{
+			description: "TOML dynamic configuration should be searched for the plugin middleware",
+			file:        "dynamic.toml",
+			content: `
+[http.middlewares.real-ip.plugin.traefik-real-ip]
+  excludedNetworks = [
+    "10.0.0.0/8",
+  ]
+  preferredProvider = "cloudflare"
+  strictStatusCode = 403
+`,
+			expectedName: "real-ip",
+		},
+		{
+			description: "Several plugin middlewares should require the middleware to be selected",
+			file:        "dynamic.yml",
+			content: `
+http:
+  middlewares:
+    first:
+      plugin:
+        traefik-real-ip: {}
+    second:
+      plugin:
+        traefik-real-ip: {}
+`,
+			expectedErr: "found 2 plugin middlewares (first, second), select one with -middleware",
+		},
+		{
+			description: "Selected middleware should be used",
+			file:        "dynamic.yml",
+			content: `
+http:
+  middlewares:
+    first:
+      plugin:
+        traefik-real-ip: {}
+    second:
+      plugin:
+        traefik-real-ip:
+          excludedNetworks: ["10.0.0.0/8"]
+          preferredProvider: cloudflare
+          strictStatusCode: 403
+`,
+			middleware:   "second",
+			expectedName: "second",
+		},
+		{
+			description: "Unknown options should be refused",
+			file:        "plugin.yml",
+			content:     "excludedNetwork: []\n",
+			expectedErr: `unknown field "excludedNetwork"`,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			path := writeFile(framework, test.file, test.content)
+			config, name, err := loadConfig(path, "", test.middleware)
+
+			if test.expectedErr != "" {
+				require.Error(framework, err)
+				assert.Contains(framework, err.Error(), test.expectedErr)
+				return
+			}
+
+			require.NoError(framework, err)
+			assert.Equal(framework, test.expectedName, name)
+			assert.Equal(framework, []string{"10.0.0.0/8"}, config.ExcludedNetworks)
+			assert.Equal(framework, "cloudflare", config.PreferredProvider)
+			assert.Equal(framework, 403, config.StrictStatusCode)
+			assert.Equal(framework, traefik_real_ip.CreateConfig().DeniedStatusCode, config.DeniedStatusCode)
+		})
+	}
+}
+
+func TestDecodeDocument(framework *testing.T) {
+	framework.Parallel()
+
+	for _, format := range []string{_formatYAML, _formatTOML, _formatJSON} {
+		_, err := decodeDocument([]byte("key = value\n: ["), format)
+		assert.Error(framework, err, format)
+	}
+
+	document, err := decodeDocument([]byte(`
+title = "real \"ip\""
+numbers = [1, 2_000]
+
+[a.b]
+c = 1.5
+`), _formatTOML)
+
+	require.NoError(framework, err)
+	assert.Equal(framework, map[string]interface{}{
+		"title":   `real "ip"`,
+		"numbers": []interface{}{int64(1), int64(2000)},
+		"a": map[string]interface{}{
+			"b": map[string]interface{}{"c": 1.5},
+		},
+	}, document)
+
+	_, err = decodeDocument([]byte("{}"), "ini")
+	assert.EqualError(framework, err, "format ini is not valid, only the following ones are supported: yaml, toml, json")
+}
+
+func TestRun(framework *testing.T) {
+	framework.Parallel()
+
+	configPath := writeFile(framework, "plugin.yml", `
+excludedNetworks: ["private"]
+trustedNetworks: ["10.0.0.0/8"]
+`)
+	requestPath := writeFile(framework, "request.txt", "GET /whoami HTTP/1.1\r\nHost: example.com\r\nX-Forwarded-For: 10.0.0.2, bogus, 8.8.8.8\r\n\r\n")
+
+	testCases := []struct {
+		description      string
+		arguments        []string
+		expectedCode     int
+		expectedOutput   []string
+		expectedStderr   string
+		expectedExplains bool
+	}{
+		{
+			description:  "Raw request should be explained",
+			arguments:    []string{"-config", configPath, "-request", requestPath, "-remote-addr", "10.0.0.1:5555"},
+			expectedCode: 0,
+			expectedOutput: []string{
+				"real ip:  8.8.8.8 (provider generic, header X-Forwarded-For)",
+				"peer:     10.0.0.1:5555 (trusted)",
+				"verdict:  forwarded with status 200",
+				`rejected "10.0.0.2" from X-Forwarded-For: excluded by excludedNetworks:private (10.0.0.0/8)`,
+				`rejected "bogus" from X-Forwarded-For: malformed`,
+				"X-Real-Ip: 8.8.8.8",
+			},
+		},
+		{
+			description:  "Headers should be explained with the default peer",
+			arguments:    []string{"-config", configPath, "-header", "X-Forwarded-For: 8.8.4.4"},
+			expectedCode: 0,
+			expectedOutput: []string{
+				"real ip:  not resolved, forwarding headers of untrusted peers are ignored",
+				"peer:     192.0.2.1:1234 (untrusted)",
+				"X-Real-Ip: 192.0.2.1",
+			},
+		},
+		{
+			description:      "Explanation should be printed as JSON",
+			arguments:        []string{"-config", configPath, "-request", requestPath, "-remote-addr", "10.0.0.1:5555", "-json"},
+			expectedCode:     0,
+			expectedExplains: true,
+		},
+		{
+			description:    "Missing configuration should be a usage error",
+			arguments:      []string{"-header", "X-Forwarded-For: 8.8.8.8"},
+			expectedCode:   2,
+			expectedStderr: "-config is required",
+		},
+		{
+			description:    "Header without a colon should be a usage error",
+			arguments:      []string{"-config", configPath, "-header", "X-Forwarded-For"},
+			expectedCode:   2,
+			expectedStderr: `"Name: value" form`,
+		},
+		{
+			description:    "Invalid configuration should be reported",
+			arguments:      []string{"-config", writeFile(framework, "invalid.json", `{"providers": ["unknown"]}`)},
+			expectedCode:   1,
+			expectedStderr: "providers[0]: provider unknown is not valid",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+
+			code := run(test.arguments, stdout, stderr)
+
+			assert.Equal(framework, test.expectedCode, code, stderr.String())
+			for _, line := range test.expectedOutput {
+				assert.Contains(framework, stdout.String(), line)
+			}
+			if test.expectedStderr != "" {
+				assert.Contains(framework, stderr.String(), test.expectedStderr)
+			}
+			if test.expectedExplains {
+				explanation := &traefik_real_ip.Explanation{}
+				require.NoError(framework, json.Unmarshal(stdout.Bytes(), explanation))
+				require.NotNil(framework, explanation.Result)
+				assert.Equal(framework, "8.8.8.8", explanation.Result.IP)
+				assert.Empty(framework, explanation.Verdict.Rejected)
+			}
+		})
+	}
+}
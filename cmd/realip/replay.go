@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	traefik_real_ip "github.com/darki73/traefik-real-ip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+)
+
+const (
+	_changeIP         = "ip_changed"
+	_changeResolved   = "newly_resolved"
+	_changeUnresolved = "no_longer_resolved"
+	_changeSource     = "source_changed"
+	_changeVerdict    = "verdict_changed"
+)
+
+// _changes holds the kinds of changes in the order they are reported.
+var _changes = []string{_changeIP, _changeResolved, _changeUnresolved, _changeSource, _changeVerdict}
+
+// _accessLogHeaderPrefix prefixes the request headers captured in Traefik access logs.
+const _accessLogHeaderPrefix = "request_"
+
+// _maxSkippedReports is the number of skipped entries reported on the standard error.
+const _maxSkippedReports = 5
+
+// replayOutcome describes what the middleware did with a replayed request.
+type replayOutcome struct {
+	IP       string `json:"ip,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Header   string `json:"header,omitempty"`
+	Status   int    `json:"status"`
+	Rejected string `json:"rejected,omitempty"`
+}
+
+// replaySample describes a request whose outcome differs between the configurations.
+type replaySample struct {
+	Source     string            `json:"source"`
+	RemoteAddr string            `json:"remoteAddr"`
+	Headers    map[string]string `json:"headers"`
+	Change     string            `json:"change"`
+	Before     replayOutcome     `json:"before"`
+	After      replayOutcome     `json:"after"`
+}
+
+// replayReport summarizes the differences between the configurations.
+type replayReport struct {
+	Replayed  int            `json:"replayed"`
+	Skipped   int            `json:"skipped"`
+	Unchanged int            `json:"unchanged"`
+	Changed   map[string]int `json:"changed"`
+	Samples   []replaySample `json:"samples"`
+}
+
+// runReplay replays access logs through two configurations and reports the differences.
+func runReplay(arguments []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("realip replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	beforePath := flags.String("before", "", "path to the current configuration (required)")
+	afterPath := flags.String("after", "", "path to the proposed configuration (required)")
+	format := flags.String("format", "", "format of the configurations: yaml, toml or json (default is detected from the extension)")
+	beforeMiddleware := flags.String("before-middleware", "", "name of the middleware in the current dynamic configuration")
+	afterMiddleware := flags.String("after-middleware", "", "name of the middleware in the proposed dynamic configuration")
+	samples := flags.Int("samples", 10, "number of differing requests to show")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: realip replay -before current.yml -after proposed.yml [access.log ...]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(arguments); err != nil {
+		return 2
+	}
+
+	if *beforePath == "" || *afterPath == "" {
+		fmt.Fprintln(stderr, "realip: -before and -after are required")
+		flags.Usage()
+		return 2
+	}
+
+	before, err := newReplayExplainer(*beforePath, *format, *beforeMiddleware)
+	if err != nil {
+		fmt.Fprintf(stderr, "realip: %s\n", err)
+		return 1
+	}
+
+	after, err := newReplayExplainer(*afterPath, *format, *afterMiddleware)
+	if err != nil {
+		fmt.Fprintf(stderr, "realip: %s\n", err)
+		return 1
+	}
+
+	report := &replayReport{Changed: make(map[string]int), Samples: make([]replaySample, 0)}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	for _, path := range paths {
+		if err := replayFile(path, before, after, report, *samples, stderr); err != nil {
+			fmt.Fprintf(stderr, "realip: %s\n", err)
+			return 1
+		}
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(report)
+		return 0
+	}
+
+	printReport(stdout, report)
+	return 0
+}
+
+// newReplayExplainer creates the explainer of a configuration used for replays.
+// Rate limiting is disabled, as replayed requests do not keep their timing, and only errors are logged.
+func newReplayExplainer(path string, format string, middleware string) (*explainer, error) {
+	config, name, err := loadConfig(path, format, middleware)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = "realip"
+	}
+
+	config.RateLimit = nil
+	if config.Logging == nil {
+		config.Logging = traefik_real_ip.CreateLoggingConfig()
+	}
+	config.Logging.Level = "error"
+	config.LogLevel = ""
+
+	explainer, err := newExplainer(config, name)
+	if err != nil {
+		return nil, fmt.Errorf("configuration %s: %w", path, err)
+	}
+
+	return explainer, nil
+}
+
+// replayFile replays every entry of the access log ("-" for the standard input) and adds it to the report.
+func replayFile(path string, before *explainer, after *explainer, report *replayReport, samples int, stderr io.Writer) error {
+	var reader io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		source := fmt.Sprintf("%s:%d", path, line)
+
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		request, err := parseAccessLogEntry(scanner.Bytes())
+		if err != nil {
+			if report.Skipped < _maxSkippedReports {
+				fmt.Fprintf(stderr, "realip: skipping %s: %s\n", source, err)
+			}
+			report.Skipped++
+			continue
+		}
+
+		beforeOutcome, err := replayRequest(before, request)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+
+		afterOutcome, err := replayRequest(after, request)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+
+		report.Replayed++
+
+		change := compareOutcomes(beforeOutcome, afterOutcome)
+		if change == "" {
+			report.Unchanged++
+			continue
+		}
+
+		report.Changed[change]++
+		if len(report.Samples) < samples {
+			headers := make(map[string]string, len(request.Header))
+			for header := range request.Header {
+				headers[header] = request.Header.Get(header)
+			}
+
+			report.Samples = append(report.Samples, replaySample{
+				Source:     source,
+				RemoteAddr: request.RemoteAddr,
+				Headers:    headers,
+				Change:     change,
+				Before:     beforeOutcome,
+				After:      afterOutcome,
+			})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// parseAccessLogEntry builds the request of a Traefik JSON access log entry.
+// The peer is taken from ClientAddr (or ClientHost and ClientPort) and the headers from the request_ fields.
+// Redacted headers are dropped, as their value is not known.
+func parseAccessLogEntry(line []byte) (*http.Request, error) {
+	entry := make(map[string]interface{})
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return nil, fmt.Errorf("entry is not valid JSON: %w", err)
+	}
+
+	remoteAddr := stringField(entry, "ClientAddr")
+	if remoteAddr == "" {
+		host := stringField(entry, "ClientHost")
+		if host == "" {
+			return nil, fmt.Errorf("entry has neither ClientAddr nor ClientHost")
+		}
+
+		port := stringField(entry, "ClientPort")
+		if port == "" {
+			port = "0"
+		}
+		remoteAddr = net.JoinHostPort(host, port)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	request.RemoteAddr = remoteAddr
+	if method := stringField(entry, "RequestMethod"); method != "" {
+		request.Method = method
+	}
+	if host := stringField(entry, "RequestHost"); host != "" {
+		request.Host = host
+	}
+
+	for field := range entry {
+		if !strings.HasPrefix(field, _accessLogHeaderPrefix) {
+			continue
+		}
+
+		value := stringField(entry, field)
+		if value == "" || value == "REDACTED" {
+			continue
+		}
+
+		request.Header.Set(strings.TrimPrefix(field, _accessLogHeaderPrefix), value)
+	}
+
+	return request, nil
+}
+
+// stringField returns the field of the entry if it is a string.
+func stringField(entry map[string]interface{}, field string) string {
+	value, _ := entry[field].(string)
+	return value
+}
+
+// replayRequest returns the outcome of the request with the configuration of the explainer.
+func replayRequest(explainer *explainer, request *http.Request) (replayOutcome, error) {
+	explanation, err := explainer.explain(request)
+	if err != nil {
+		return replayOutcome{}, err
+	}
+
+	outcome := replayOutcome{Status: explanation.Verdict.Status, Rejected: explanation.Verdict.Rejected}
+	if explanation.Result != nil {
+		outcome.IP = explanation.Result.IP
+		outcome.Provider = explanation.Result.Provider
+		outcome.Header = explanation.Result.Header
+	}
+
+	return outcome, nil
+}
+
+// compareOutcomes returns the kind of change between the outcomes, or an empty string if they are the same.
+func compareOutcomes(before replayOutcome, after replayOutcome) string {
+	switch {
+	case before.IP != after.IP && before.IP == "":
+		return _changeResolved
+	case before.IP != after.IP && after.IP == "":
+		return _changeUnresolved
+	case before.IP != after.IP:
+		return _changeIP
+	case before.Provider != after.Provider || before.Header != after.Header:
+		return _changeSource
+	case before.Status != after.Status || before.Rejected != after.Rejected:
+		return _changeVerdict
+	default:
+		return ""
+	}
+}
+
+// printReport prints the report in a human readable form.
+func printReport(writer io.Writer, report *replayReport) {
+	changed := 0
+	for _, count := range report.Changed {
+		changed += count
+	}
+
+	fmt.Fprintf(writer, "replayed:   %d\n", report.Replayed)
+	fmt.Fprintf(writer, "skipped:    %d\n", report.Skipped)
+	fmt.Fprintf(writer, "unchanged:  %d\n", report.Unchanged)
+	fmt.Fprintf(writer, "changed:    %d\n", changed)
+	for _, change := range _changes {
+		if count := report.Changed[change]; count > 0 {
+			fmt.Fprintf(writer, "  %-20s %d\n", strings.ReplaceAll(change, "_", " ")+":", count)
+		}
+	}
+
+	if len(report.Samples) == 0 {
+		return
+	}
+
+	fmt.Fprintln(writer, "\nsamples:")
+	for _, sample := range report.Samples {
+		fmt.Fprintf(writer, "  %s from %s (%s)\n", sample.Source, sample.RemoteAddr, strings.ReplaceAll(sample.Change, "_", " "))
+		for _, header := range sortedKeys(sample.Headers) {
+			fmt.Fprintf(writer, "    %s: %s\n", header, sample.Headers[header])
+		}
+		fmt.Fprintf(writer, "    before: %s\n", describeOutcome(sample.Before))
+		fmt.Fprintf(writer, "    after:  %s\n", describeOutcome(sample.After))
+	}
+}
+
+// describeOutcome describes the outcome on a single line.
+func describeOutcome(outcome replayOutcome) string {
+	resolved := "not resolved"
+	if outcome.IP != "" {
+		resolved = fmt.Sprintf("%s (provider %s, header %s)", outcome.IP, outcome.Provider, outcome.Header)
+	}
+
+	if outcome.Rejected != "" {
+		return fmt.Sprintf("%s, rejected (%s) with status %d", resolved, outcome.Rejected, outcome.Status)
+	}
+
+	return fmt.Sprintf("%s, forwarded with status %d", resolved, outcome.Status)
+}
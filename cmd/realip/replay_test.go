@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAccessLogEntry(framework *testing.T) {
+	framework.Parallel()
+
+	testCases := []struct {
+		description        string
+		entry              string
+		expectedRemoteAddr string
+		expectedHeaders    map[string]string
+		expectedError      bool
+	}{
+		{
+			description:        "Client address and request headers should be used",
+			entry:              `{"ClientAddr":"10.0.0.1:5555","RequestHost":"example.com","request_X-Forwarded-For":"8.8.8.8","downstream_Content-Type":"text/plain"}`,
+			expectedRemoteAddr: "10.0.0.1:5555",
+			expectedHeaders:    map[string]string{"X-Forwarded-For": "8.8.8.8"},
+		},
+		{
+			description:        "Client host and port should be used without the client address",
+			entry:              `{"ClientHost":"2001:db8::1","ClientPort":"443","request_Cf-Connecting-Ip":"8.8.8.8"}`,
+			expectedRemoteAddr: "[2001:db8::1]:443",
+			expectedHeaders:    map[string]string{"Cf-Connecting-Ip": "8.8.8.8"},
+		},
+		{
+			description:        "Redacted headers should be dropped",
+			entry:              `{"ClientAddr":"10.0.0.1:5555","request_X-Forwarded-For":"REDACTED"}`,
+			expectedRemoteAddr: "10.0.0.1:5555",
+			expectedHeaders:    map[string]string{},
+		},
+		{
+			description:   "Entries without the client should be refused",
+			entry:         `{"request_X-Forwarded-For":"8.8.8.8"}`,
+			expectedError: true,
+		},
+		{
+			description:   "Common log format should be refused",
+			entry:         `10.0.0.1 - - [18/Oct/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 0`,
+			expectedError: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			request, err := parseAccessLogEntry([]byte(test.entry))
+			if test.expectedError {
+				assert.Error(framework, err)
+				return
+			}
+
+			require.NoError(framework, err)
+			assert.Equal(framework, test.expectedRemoteAddr, request.RemoteAddr)
+
+			headers := make(map[string]string)
+			for header := range request.Header {
+				headers[header] = request.Header.Get(header)
+			}
+			assert.Equal(framework, test.expectedHeaders, headers)
+		})
+	}
+}
+
+func TestCompareOutcomes(framework *testing.T) {
+	resolved := replayOutcome{IP: "8.8.8.8", Provider: "generic", Header: "X-Forwarded-For", Status: 200}
+
+	testCases := []struct {
+		description    string
+		before         replayOutcome
+		after          replayOutcome
+		expectedChange string
+	}{
+		{"Same outcomes should be unchanged", resolved, resolved, ""},
+		{"Different IPs should be reported", resolved, replayOutcome{IP: "8.8.4.4", Provider: "generic", Header: "X-Forwarded-For", Status: 200}, _changeIP},
+		{"Newly resolved IPs should be reported", replayOutcome{Status: 200}, resolved, _changeResolved},
+		{"Lost IPs should be reported", resolved, replayOutcome{Status: 200}, _changeUnresolved},
+		{"Different providers should be reported", resolved, replayOutcome{IP: "8.8.8.8", Provider: "cloudflare", Header: "Cf-Connecting-Ip", Status: 200}, _changeSource},
+		{"Different verdicts should be reported", resolved, replayOutcome{IP: "8.8.8.8", Provider: "generic", Header: "X-Forwarded-For", Status: 403, Rejected: "denied"}, _changeVerdict},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(framework, test.expectedChange, compareOutcomes(test.before, test.after), test.description)
+	}
+}
+
+func TestReplay(framework *testing.T) {
+	framework.Parallel()
+
+	before := writeFile(framework, "before.yml", `excludedNetworks: ["10.0.0.0/8"]`)
+	after := writeFile(framework, "after.toml", `
+excludedNetworks = ["private"]
+strict = true
+`)
+	accessLog := writeFile(framework, "access.log", `{"ClientAddr":"10.0.0.1:5555","request_X-Forwarded-For":"192.168.1.1, 8.8.8.8"}
+{"ClientAddr":"10.0.0.1:5555","request_X-Forwarded-For":"8.8.8.8, 192.168.1.1"}
+not json
+
+{"ClientAddr":"10.0.0.1:5555","request_X-Forwarded-For":"10.0.0.3"}
+{"ClientAddr":"10.0.0.1:5555","request_X-Forwarded-For":"172.16.0.1"}
+`)
+
+	framework.Run("Report should be printed", func(framework *testing.T) {
+		framework.Parallel()
+
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+
+		code := run([]string{"replay", "-before", before, "-after", after, "-samples", "2", accessLog}, stdout, stderr)
+
+		require.Equal(framework, 0, code, stderr.String())
+		assert.Contains(framework, stderr.String(), "access.log:3: entry is not valid JSON")
+		for _, line := range []string{
+			"replayed:   4",
+			"skipped:    1",
+			"unchanged:  1",
+			"changed:    3",
+			"ip changed:          1",
+			"no longer resolved:  1",
+			"verdict changed:     1",
+			"access.log:1 from 10.0.0.1:5555 (ip changed)",
+			"before: 192.168.1.1 (provider generic, header X-Forwarded-For), forwarded with status 200",
+			"after:  8.8.8.8 (provider generic, header X-Forwarded-For), forwarded with status 200",
+			"after:  not resolved, rejected (strict) with status 403",
+		} {
+			assert.Contains(framework, stdout.String(), line)
+		}
+		assert.NotContains(framework, stdout.String(), "access.log:6")
+	})
+
+	framework.Run("Report should be printed as JSON", func(framework *testing.T) {
+		framework.Parallel()
+
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+
+		code := run([]string{"replay", "-before", before, "-after", after, "-json", accessLog}, stdout, stderr)
+		require.Equal(framework, 0, code, stderr.String())
+
+		report := &replayReport{}
+		require.NoError(framework, json.Unmarshal(stdout.Bytes(), report))
+		assert.Equal(framework, 4, report.Replayed)
+		assert.Equal(framework, map[string]int{_changeIP: 1, _changeUnresolved: 1, _changeVerdict: 1}, report.Changed)
+		require.Len(framework, report.Samples, 3)
+		assert.Equal(framework, "8.8.8.8", report.Samples[0].After.IP)
+	})
+
+	framework.Run("Both configurations should be required", func(framework *testing.T) {
+		framework.Parallel()
+
+		stderr := &bytes.Buffer{}
+		code := run([]string{"replay", "-before", before, accessLog}, &bytes.Buffer{}, stderr)
+
+		assert.Equal(framework, 2, code)
+		assert.Contains(framework, stderr.String(), "-before and -after are required")
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+)
+
+// headerFlags collects the repeated -header flags.
+type headerFlags []string
+
+// String returns the headers, one per line.
+func (headers *headerFlags) String() string {
+	return strings.Join(*headers, "\n")
+}
+
+// Set adds a header in the "Name: value" form.
+func (headers *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header %s is not valid, it must be in the \"Name: value\" form", value)
+	}
+
+	*headers = append(*headers, value)
+	return nil
+}
+
+// loadRequest builds the request to resolve.
+// The request is read from the raw HTTP request in the file ("-" for the standard input) if one is set,
+// and the headers are then added to it. The remote address is always taken from remoteAddr,
+// as a captured request does not carry it.
+func loadRequest(path string, headers []string, remoteAddr string) (*http.Request, error) {
+	request := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+
+	if path != "" {
+		var reader io.Reader = os.Stdin
+		if path != "-" {
+			file, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer file.Close()
+			reader = file
+		}
+
+		parsed, err := http.ReadRequest(bufio.NewReader(reader))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the request from %s: %w", path, err)
+		}
+		request = parsed
+	}
+
+	for _, header := range headers {
+		name, value, _ := strings.Cut(header, ":")
+		request.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	request.RemoteAddr = remoteAddr
+
+	return request, nil
+}
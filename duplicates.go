@@ -0,0 +1,65 @@
+package traefik_real_ip
+
+import (
+	"fmt"
+	"github.com/darki73/traefik-real-ip/pkg/providers"
+	"net/http"
+	"strings"
+)
+
+// DuplicateHeadersConfig holds the handling of single value forwarding headers, such as CF-Connecting-IP,
+// which were sent more than once. List headers, such as X-Forwarded-For, are always merged instead.
+type DuplicateHeadersConfig struct {
+	Action     string `json:"action,omitempty" toml:"action,omitempty" yaml:"action,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty" toml:"statusCode,omitempty" yaml:"statusCode,omitempty"`
+}
+
+// CreateDuplicateHeadersConfig creates the default duplicate headers configuration.
+func CreateDuplicateHeadersConfig() *DuplicateHeadersConfig {
+	return &DuplicateHeadersConfig{
+		Action:     providers.DuplicateActionFirst,
+		StatusCode: http.StatusBadRequest,
+	}
+}
+
+// newDuplicateHeadersConfig validates the duplicate headers configuration and fills in the defaults.
+// When no configuration is passed, the first line of a duplicated header is used.
+func newDuplicateHeadersConfig(config *DuplicateHeadersConfig) (*DuplicateHeadersConfig, error) {
+	if config == nil {
+		return CreateDuplicateHeadersConfig(), nil
+	}
+
+	duplicates := *config
+
+	switch duplicates.Action {
+	case "":
+		duplicates.Action = providers.DuplicateActionFirst
+	case providers.DuplicateActionFirst, providers.DuplicateActionLast, providers.DuplicateActionIgnore, providers.DuplicateActionReject:
+	default:
+		return nil, fmt.Errorf(
+			"duplicate headers action %s is not valid, only the following ones are supported: %s",
+			duplicates.Action,
+			strings.Join([]string{
+				providers.DuplicateActionFirst,
+				providers.DuplicateActionLast,
+				providers.DuplicateActionIgnore,
+				providers.DuplicateActionReject,
+			}, ", "),
+		)
+	}
+
+	if duplicates.StatusCode == 0 {
+		duplicates.StatusCode = http.StatusBadRequest
+	}
+
+	if duplicates.StatusCode < 400 || duplicates.StatusCode > 599 {
+		return nil, fmt.Errorf("duplicate headers status code %d is not valid, only 4xx and 5xx codes are supported", duplicates.StatusCode)
+	}
+
+	return &duplicates, nil
+}
+
+// isDuplicateRejected returns true if the request must be rejected because a single value header was duplicated.
+func (trip *TraefikRealIP) isDuplicateRejected(res *resolution) bool {
+	return trip.duplicateHeaders.Action == providers.DuplicateActionReject && res.hasDuplicates()
+}
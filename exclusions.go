@@ -0,0 +1,77 @@
+package traefik_real_ip
+
+import (
+	"fmt"
+	"github.com/darki73/traefik-real-ip/pkg/cidr"
+	"github.com/darki73/traefik-real-ip/pkg/providers"
+	"github.com/darki73/traefik-real-ip/pkg/resolver"
+	"strings"
+)
+
+// ProviderConfig holds the configuration specific to a single provider.
+// Its exclusions are merged with the global ones, unless override is set, in which case they replace them.
+type ProviderConfig struct {
+	ExcludedNetworks  []string `json:"excludedNetworks,omitempty" toml:"excludedNetworks,omitempty" yaml:"excludedNetworks,omitempty"`
+	ExcludedAddresses []string `json:"excludedAddresses,omitempty" toml:"excludedAddresses,omitempty" yaml:"excludedAddresses,omitempty"`
+	Override          bool     `json:"override,omitempty" toml:"override,omitempty" yaml:"override,omitempty"`
+}
+
+// newProviderExclusions creates the exclusions matcher of every provider with its own configuration.
+// Provider specific entries are labelled with the provider name, and take precedence over global entries for the same network.
+func (trip *TraefikRealIP) newProviderExclusions(config *Config) (map[string]*cidr.Matcher, error) {
+	exclusions := make(map[string]*cidr.Matcher, len(config.ProviderOptions))
+
+	for name, options := range config.ProviderOptions {
+		if !trip.IsValidProvider(name) {
+			return nil, fmt.Errorf(
+				"provider options %s are not valid, only the following providers are supported: %s",
+				name,
+				strings.Join(trip.availableProviders, ", "),
+			)
+		}
+
+		if options == nil {
+			continue
+		}
+
+		label := "providerOptions." + name + "."
+
+		matcher, err := resolver.NewMatcher(options.ExcludedNetworks, label+"excludedNetworks")
+		if err != nil {
+			return nil, err
+		}
+		insertAddresses(matcher, options.ExcludedAddresses, label+"excludedAddresses")
+
+		if !options.Override {
+			if err := resolver.InsertNetworks(matcher, config.ExcludedNetworks, "excludedNetworks"); err != nil {
+				return nil, err
+			}
+			insertAddresses(matcher, config.ExcludedAddresses, "excludedAddresses")
+		}
+
+		exclusions[name] = matcher
+	}
+
+	return exclusions, nil
+}
+
+// GetProviderExclusions returns the matcher of excluded networks and addresses used by the provider.
+// Providers without their own configuration use the global exclusions.
+func (trip *TraefikRealIP) GetProviderExclusions(provider string) *cidr.Matcher {
+	if exclusions, ok := trip.providerExclusions[provider]; ok {
+		return exclusions
+	}
+
+	return trip.GetExclusions()
+}
+
+// insertAddresses inserts the addresses into the matcher, values which are not addresses are skipped.
+func insertAddresses(matcher *cidr.Matcher, values []string, label string) {
+	for _, value := range values {
+		address, err := providers.ParseAddress(value)
+
+		if err == nil {
+			matcher.InsertAddr(address.Addr(), label)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package traefik_real_ip
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+)
+
+// ExplainConfig holds the configuration of the explain mode.
+// Requests carrying the header with the secret are answered with a JSON document describing the resolution,
+// instead of being passed to the next handler. Explain mode is disabled unless secret is set.
+type ExplainConfig struct {
+	Header string `json:"header,omitempty" toml:"header,omitempty" yaml:"header,omitempty"`
+	Secret string `json:"secret,omitempty" toml:"secret,omitempty" yaml:"secret,omitempty"`
+}
+
+// CreateExplainConfig creates the default explain configuration, with explain mode disabled.
+func CreateExplainConfig() *ExplainConfig {
+	return &ExplainConfig{
+		Header: "X-Real-IP-Explain",
+		Secret: "",
+	}
+}
+
+// newExplainConfig fills in the defaults of the explain configuration.
+func newExplainConfig(config *ExplainConfig) *ExplainConfig {
+	explain := CreateExplainConfig()
+
+	if config == nil {
+		return explain
+	}
+
+	if config.Header != "" {
+		explain.Header = config.Header
+	}
+	explain.Secret = config.Secret
+
+	return explain
+}
+
+// Explanation describes how the real IP of a request was determined and what the middleware did with it.
+type Explanation struct {
+	Name      string                `json:"name"`
+	Peer      ExplanationPeer       `json:"peer"`
+	Providers []ExplanationProvider `json:"providers"`
+	Result    *ExplanationResult    `json:"result"`
+	Verdict   ExplanationVerdict    `json:"verdict"`
+}
+
+// ExplanationPeer describes the connection peer.
+type ExplanationPeer struct {
+	Address string `json:"address"`
+	Trusted bool   `json:"trusted"`
+}
+
+// ExplanationProvider describes the headers a consulted provider saw and the candidates it rejected.
+type ExplanationProvider struct {
+	Provider   string                 `json:"provider"`
+	Values     map[string]string      `json:"values"`
+	Rejected   []ExplanationRejection `json:"rejected,omitempty"`
+	Exceeded   []ExplanationViolation `json:"exceeded,omitempty"`
+	Duplicated []string               `json:"duplicated,omitempty"`
+	Resolved   bool                   `json:"resolved"`
+}
+
+// ExplanationRejection describes a header value which was not accepted as the real IP.
+type ExplanationRejection struct {
+	Header  string `json:"header"`
+	Value   string `json:"value"`
+	Reason  string `json:"reason"`
+	Network string `json:"network,omitempty"`
+	Label   string `json:"label,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ExplanationViolation describes a limit exceeded by a header.
+type ExplanationViolation struct {
+	Header string `json:"header"`
+	Limit  string `json:"limit"`
+}
+
+// ExplanationResult describes the real IP and where it was taken from.
+type ExplanationResult struct {
+	IP       string `json:"ip"`
+	Port     uint16 `json:"port,omitempty"`
+	Provider string `json:"provider"`
+	Header   string `json:"header"`
+}
+
+// ExplanationVerdict describes the response the request would have received.
+// Forwarded holds the headers the next handler would have seen, set only when the request was not rejected.
+type ExplanationVerdict struct {
+	Status    int               `json:"status"`
+	Rejected  string            `json:"rejected,omitempty"`
+	Forwarded map[string]string `json:"forwarded,omitempty"`
+}
+
+// isExplainRequest returns true if the request carries the explain header with the configured secret.
+func (trip *TraefikRealIP) isExplainRequest(request *http.Request) bool {
+	if trip.explainConfig.Secret == "" {
+		return false
+	}
+
+	value := request.Header.Get(trip.explainConfig.Header)
+	if value == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(value), []byte(trip.explainConfig.Secret)) == 1
+}
+
+// explain handles the request exactly as ServeHTTP would, but answers with the explanation instead of passing it on.
+// Counters, rate limits and caches are affected as for any other request.
+func (trip *TraefikRealIP) explain(responseWriter http.ResponseWriter, request *http.Request) {
+	clone := request.Clone(request.Context())
+	clone.Header.Del(trip.explainConfig.Header)
+
+	recorder := &explainRecorder{header: make(http.Header)}
+	forwarded := make(map[string]string)
+
+	next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		for header := range request.Header {
+			forwarded[header] = request.Header.Get(header)
+		}
+		responseWriter.WriteHeader(http.StatusOK)
+	})
+
+	res, rejected := trip.handle(recorder, clone, next)
+
+	explanation := newExplanation(trip.name, request.RemoteAddr, res)
+	explanation.Verdict = ExplanationVerdict{Status: recorder.status, Rejected: rejected}
+	if rejected == "" {
+		explanation.Verdict.Forwarded = forwarded
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.Header().Set("Cache-Control", "no-store")
+	responseWriter.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(responseWriter).Encode(explanation)
+}
+
+// newExplanation describes the resolution of the request from the peer.
+func newExplanation(name string, peer string, res *resolution) *Explanation {
+	explanation := &Explanation{
+		Name:      name,
+		Peer:      ExplanationPeer{Address: peer, Trusted: res.trusted},
+		Providers: make([]ExplanationProvider, 0, len(res.consulted)),
+	}
+
+	for _, result := range res.consulted {
+		provider := ExplanationProvider{
+			Provider:   result.Provider,
+			Values:     result.Values,
+			Duplicated: result.Duplicated,
+			Resolved:   result.IsResolved(),
+		}
+
+		for _, violation := range result.Exceeded {
+			provider.Exceeded = append(provider.Exceeded, ExplanationViolation{Header: violation.Header, Limit: violation.Limit})
+		}
+
+		for _, rejection := range result.Rejected {
+			explained := ExplanationRejection{
+				Header: rejection.Header,
+				Value:  rejection.Value,
+				Reason: rejection.Reason,
+				Label:  rejection.Match.Label,
+			}
+			if rejection.Match.Prefix.IsValid() {
+				explained.Network = rejection.Match.Prefix.String()
+			}
+			if rejection.Err != nil {
+				explained.Error = rejection.Err.Error()
+			}
+			provider.Rejected = append(provider.Rejected, explained)
+		}
+
+		explanation.Providers = append(explanation.Providers, provider)
+	}
+
+	if res.isResolved() {
+		explanation.Result = &ExplanationResult{
+			IP:       res.result.IP.String(),
+			Port:     res.result.Port,
+			Provider: res.result.Provider,
+			Header:   res.result.Header,
+		}
+	}
+
+	return explanation
+}
+
+// explainRecorder records the status of the response written while explaining a request, discarding the body.
+type explainRecorder struct {
+	header http.Header
+	status int
+}
+
+// Header returns the headers of the response.
+func (recorder *explainRecorder) Header() http.Header {
+	return recorder.header
+}
+
+// Write discards the body, recording the implicit status.
+func (recorder *explainRecorder) Write(body []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+
+	return len(body), nil
+}
+
+// WriteHeader records the status of the response.
+func (recorder *explainRecorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+}
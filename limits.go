@@ -0,0 +1,81 @@
+package traefik_real_ip
+
+import (
+	"fmt"
+	"github.com/darki73/traefik-real-ip/pkg/providers"
+	"net/http"
+	"strings"
+)
+
+// LimitsConfig holds the limits protecting the plugin from abusive forwarding headers, zero disables a limit.
+type LimitsConfig struct {
+	MaxHeaderBytes int    `json:"maxHeaderBytes,omitempty" toml:"maxHeaderBytes,omitempty" yaml:"maxHeaderBytes,omitempty"`
+	MaxChainLength int    `json:"maxChainLength,omitempty" toml:"maxChainLength,omitempty" yaml:"maxChainLength,omitempty"`
+	MaxHeaderLines int    `json:"maxHeaderLines,omitempty" toml:"maxHeaderLines,omitempty" yaml:"maxHeaderLines,omitempty"`
+	Action         string `json:"action,omitempty" toml:"action,omitempty" yaml:"action,omitempty"`
+	StatusCode     int    `json:"statusCode,omitempty" toml:"statusCode,omitempty" yaml:"statusCode,omitempty"`
+}
+
+// CreateLimitsConfig creates the default limits configuration.
+func CreateLimitsConfig() *LimitsConfig {
+	limits := providers.DefaultLimits()
+
+	return &LimitsConfig{
+		MaxHeaderBytes: limits.MaxHeaderBytes,
+		MaxChainLength: limits.MaxChainLength,
+		MaxHeaderLines: limits.MaxHeaderLines,
+		Action:         limits.Action,
+		StatusCode:     http.StatusRequestHeaderFieldsTooLarge,
+	}
+}
+
+// newLimitsConfig validates the limits configuration and fills in the defaults.
+// When no configuration is passed, the default limits are used.
+func newLimitsConfig(config *LimitsConfig) (*LimitsConfig, error) {
+	if config == nil {
+		return CreateLimitsConfig(), nil
+	}
+
+	limits := *config
+
+	if limits.MaxHeaderBytes < 0 || limits.MaxChainLength < 0 || limits.MaxHeaderLines < 0 {
+		return nil, fmt.Errorf("limits must not be negative")
+	}
+
+	switch limits.Action {
+	case "":
+		limits.Action = providers.LimitActionTruncate
+	case providers.LimitActionTruncate, providers.LimitActionIgnore, providers.LimitActionReject:
+	default:
+		return nil, fmt.Errorf(
+			"limits action %s is not valid, only the following ones are supported: %s",
+			limits.Action,
+			strings.Join([]string{providers.LimitActionTruncate, providers.LimitActionIgnore, providers.LimitActionReject}, ", "),
+		)
+	}
+
+	if limits.StatusCode == 0 {
+		limits.StatusCode = http.StatusRequestHeaderFieldsTooLarge
+	}
+
+	if limits.StatusCode < 400 || limits.StatusCode > 599 {
+		return nil, fmt.Errorf("limits status code %d is not valid, only 4xx and 5xx codes are supported", limits.StatusCode)
+	}
+
+	return &limits, nil
+}
+
+// getProviderLimits returns the limits applied by the providers.
+func (trip *TraefikRealIP) getProviderLimits() providers.Limits {
+	return providers.Limits{
+		MaxHeaderBytes: trip.limits.MaxHeaderBytes,
+		MaxChainLength: trip.limits.MaxChainLength,
+		MaxHeaderLines: trip.limits.MaxHeaderLines,
+		Action:         trip.limits.Action,
+	}
+}
+
+// isOverLimits returns true if the request must be rejected because its headers exceeded the limits.
+func (trip *TraefikRealIP) isOverLimits(res *resolution) bool {
+	return trip.limits.Action == providers.LimitActionReject && res.hasExceeded()
+}
@@ -0,0 +1,363 @@
+package traefik_real_ip
+
+import (
+	"fmt"
+	"github.com/darki73/traefik-real-ip/pkg/networks"
+	"net/netip"
+	"sort"
+)
+
+// Severities of lint warnings, from the least to the most severe.
+const (
+	LintSeverityInfo     = "info"
+	LintSeverityWarning  = "warning"
+	LintSeverityCritical = "critical"
+)
+
+const (
+	_lintRuleExcludesEverything       = "excludes-everything"
+	_lintRuleOverlappingNetworks      = "overlapping-networks"
+	_lintRulePreferredProviderMissing = "preferred-provider-not-listed"
+	_lintRuleUntrustedForwardedFor    = "untrusted-forwarded-for"
+	_lintRuleTrustsEverything         = "trusts-everything"
+	_lintRuleUnverifiedProviderHeader = "unverified-provider-header"
+	_lintRuleUnverifiableSpoofingRule = "unverifiable-spoofing-rule"
+	_lintRuleSpoofableRateLimit       = "spoofable-rate-limit"
+	_lintRuleAllowsEverything         = "allows-everything"
+	_lintRulePublicMetrics            = "public-metrics"
+	_lintRuleWeakExplainSecret        = "weak-explain-secret"
+)
+
+// _minExplainSecretLength is the length under which the explain secret is considered easy to guess.
+const _minExplainSecretLength = 16
+
+// LintWarning describes an option which is valid, but likely to be a mistake.
+type LintWarning struct {
+	// Rule is the name of the rule which produced the warning.
+	Rule string `json:"rule"`
+	// Field is the path of the option, such as excludedNetworks[2].
+	Field string `json:"field"`
+	// Severity is info, warning or critical.
+	Severity string `json:"severity"`
+	// Message describes the problem.
+	Message string `json:"message"`
+	// Remediation describes how to fix the problem.
+	Remediation string `json:"remediation"`
+}
+
+// String returns the warning on a single line.
+func (warning LintWarning) String() string {
+	return fmt.Sprintf("%s %s: %s (%s)", warning.Severity, warning.Field, warning.Message, warning.Rule)
+}
+
+// IsLintSeverityAtLeast returns true if the severity is at least the minimum one.
+func IsLintSeverityAtLeast(severity string, minimum string) bool {
+	return lintSeverityRank(severity) >= lintSeverityRank(minimum)
+}
+
+// lintSeverityRank orders the severities.
+func lintSeverityRank(severity string) int {
+	switch severity {
+	case LintSeverityCritical:
+		return 2
+	case LintSeverityWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// linter collects the warnings of the configuration.
+type linter struct {
+	warnings []LintWarning
+}
+
+// add records the warning of the field.
+func (l *linter) add(rule string, severity string, field string, message string, remediation string) {
+	l.warnings = append(l.warnings, LintWarning{
+		Rule:        rule,
+		Field:       field,
+		Severity:    severity,
+		Message:     message,
+		Remediation: remediation,
+	})
+}
+
+// Lint looks for options which are valid, but likely to make the real IP wrong or spoofable.
+// Unlike Validate, it never prevents the middleware from being created, and it skips the values Validate refuses.
+// Warnings are returned in the order of the options.
+func (config *Config) Lint() []LintWarning {
+	l := &linter{}
+
+	l.excludesEverything("excludedNetworks", config.ExcludedNetworks)
+	l.overlappingNetworks("excludedNetworks", config.ExcludedNetworks)
+
+	names := make([]string, 0, len(config.ProviderOptions))
+	for name := range config.ProviderOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if options := config.ProviderOptions[name]; options != nil {
+			l.excludesEverything("providerOptions."+name+".excludedNetworks", options.ExcludedNetworks)
+			l.overlappingNetworks("providerOptions."+name+".excludedNetworks", options.ExcludedNetworks)
+		}
+	}
+
+	if config.PreferredProvider != "" && config.PreferredProvider != "generic" && len(config.Providers) > 0 &&
+		!containsString(config.Providers, config.PreferredProvider) {
+		l.add(
+			_lintRulePreferredProviderMissing,
+			LintSeverityWarning,
+			"preferredProvider",
+			fmt.Sprintf("preferred provider %s is not listed in providers", config.PreferredProvider),
+			fmt.Sprintf("add %s to providers, or leave providers empty to enable them all", config.PreferredProvider),
+		)
+	}
+
+	l.trustedNetworks(config)
+	l.overlappingNetworks("trustedNetworks", config.TrustedNetworks)
+	l.unverifiedProviderHeader(config)
+	l.unverifiableSpoofingRule(config)
+
+	if config.RateLimit != nil && config.RateLimit.Average > 0 && len(config.TrustedNetworks) == 0 {
+		l.add(
+			_lintRuleSpoofableRateLimit,
+			LintSeverityWarning,
+			"rateLimit",
+			"clients are rate limited by an address they can choose, as every peer may send forwarding headers",
+			"list your proxies in trustedNetworks, so clients can not escape the limit by changing X-Forwarded-For",
+		)
+	}
+
+	for index, value := range config.Allow {
+		if isEveryAddress(value) {
+			l.add(
+				_lintRuleAllowsEverything,
+				LintSeverityInfo,
+				fmt.Sprintf("allow[%d]", index),
+				fmt.Sprintf("network %s allows every address of its family, so the allow list has no effect on it", value),
+				"remove the network, or list only the networks which should be allowed",
+			)
+		}
+	}
+	l.overlappingNetworks("allow", config.Allow)
+	l.overlappingNetworks("deny", config.Deny)
+
+	if config.Metrics != nil && config.Metrics.Path != "" {
+		for index, value := range config.Metrics.Allow {
+			if isEveryAddress(value) {
+				l.add(
+					_lintRulePublicMetrics,
+					LintSeverityWarning,
+					fmt.Sprintf("metrics.allow[%d]", index),
+					fmt.Sprintf("network %s exposes the metrics to every client", value),
+					"allow only the addresses your monitoring connects from, such as loopback",
+				)
+			}
+		}
+		l.overlappingNetworks("metrics.allow", config.Metrics.Allow)
+	}
+
+	if config.Explain != nil && config.Explain.Secret != "" && len(config.Explain.Secret) < _minExplainSecretLength {
+		l.add(
+			_lintRuleWeakExplainSecret,
+			LintSeverityWarning,
+			"explain.secret",
+			fmt.Sprintf("secret is shorter than %d characters, and explanations reveal the configuration", _minExplainSecretLength),
+			"use a long random secret, for example the output of openssl rand -hex 32",
+		)
+	}
+
+	return l.warnings
+}
+
+// excludesEverything warns about networks which exclude every address of their family.
+func (l *linter) excludesEverything(field string, values []string) {
+	for index, value := range values {
+		if !isEveryAddress(value) {
+			continue
+		}
+
+		l.add(
+			_lintRuleExcludesEverything,
+			LintSeverityCritical,
+			fmt.Sprintf("%s[%d]", field, index),
+			fmt.Sprintf("network %s excludes every address of its family, so the real IP can never be resolved from it", value),
+			"list only the networks of your proxies and load balancers, for example the private set",
+		)
+	}
+}
+
+// overlappingNetworks warns about networks of the list which overlap a network listed before them.
+// Built-in network sets are expanded, so a network already covered by a set is reported too.
+// Networks listed twice and values which are not networks are left to Validate.
+func (l *linter) overlappingNetworks(field string, values []string) {
+	listed := make(map[int][]netip.Prefix, len(values))
+
+	for index, value := range values {
+		prefixes, ok := lintPrefixes(value)
+		if !ok {
+			continue
+		}
+
+		for other := 0; other < index; other++ {
+			if values[other] == value {
+				continue
+			}
+
+			prefix, otherPrefix, found := findOverlap(prefixes, listed[other])
+			if !found {
+				continue
+			}
+
+			l.add(
+				_lintRuleOverlappingNetworks,
+				LintSeverityWarning,
+				fmt.Sprintf("%s[%d]", field, index),
+				fmt.Sprintf("%s overlaps with %s listed at %s[%d]",
+					describeNetwork(value, prefix), describeNetwork(values[other], otherPrefix), field, other),
+				"remove the narrower network, as the wider one already covers it",
+			)
+			break
+		}
+
+		listed[index] = prefixes
+	}
+}
+
+// lintPrefixes returns the networks of the value, a network in CIDR notation or a built-in network set.
+// Networks covering every address are left out, as the rules about them already report the value.
+func lintPrefixes(value string) ([]netip.Prefix, bool) {
+	if prefixes, ok := networks.Lookup(value); ok {
+		return prefixes, true
+	}
+
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil || prefix.Bits() == 0 {
+		return nil, false
+	}
+
+	return []netip.Prefix{prefix.Masked()}, true
+}
+
+// findOverlap returns the first pair of overlapping networks of the two lists.
+func findOverlap(prefixes []netip.Prefix, others []netip.Prefix) (netip.Prefix, netip.Prefix, bool) {
+	for _, prefix := range prefixes {
+		for _, other := range others {
+			if prefix.Overlaps(other) {
+				return prefix, other, true
+			}
+		}
+	}
+
+	return netip.Prefix{}, netip.Prefix{}, false
+}
+
+// describeNetwork names the network, along with the set it comes from if the value is a built-in network set.
+func describeNetwork(value string, prefix netip.Prefix) string {
+	if networks.IsNamedSet(value) {
+		return fmt.Sprintf("%s of set %s", prefix, value)
+	}
+
+	return "network " + value
+}
+
+// trustedNetworks warns about trusted networks which do not protect X-Forwarded-For.
+func (l *linter) trustedNetworks(config *Config) {
+	if len(config.TrustedNetworks) == 0 {
+		l.add(
+			_lintRuleUntrustedForwardedFor,
+			LintSeverityWarning,
+			"trustedNetworks",
+			"X-Forwarded-For is read from the left, where clients can write any address, and every peer may send it",
+			"list your proxies in trustedNetworks, so forwarding headers from other peers are ignored",
+		)
+		return
+	}
+
+	for index, value := range config.TrustedNetworks {
+		if isEveryAddress(value) {
+			l.add(
+				_lintRuleTrustsEverything,
+				LintSeverityWarning,
+				fmt.Sprintf("trustedNetworks[%d]", index),
+				fmt.Sprintf("network %s trusts every peer of its family to send forwarding headers", value),
+				"list only the networks of your proxies and load balancers",
+			)
+		}
+	}
+}
+
+// unverifiedProviderHeader warns about a preferred CDN provider whose header any client can send.
+func (l *linter) unverifiedProviderHeader(config *Config) {
+	provider := config.PreferredProvider
+	if provider != "cloudflare" && provider != "qrator" {
+		return
+	}
+
+	if containsString(config.TrustedNetworks, provider) {
+		return
+	}
+
+	// Qrator does not publish its edge networks, so they can only be listed in trustedNetworks by address.
+	if provider == "qrator" && len(config.TrustedNetworks) > 0 {
+		return
+	}
+
+	remediation := fmt.Sprintf("add the %s set to trustedNetworks, so only its edges may send the header", provider)
+	if provider == "qrator" {
+		remediation = "add the networks of your Qrator edge servers to trustedNetworks, so only they may send the header"
+	}
+
+	// The spoofing rule only verifies Cloudflare, as Qrator edges are only known through trustedNetworks.
+	if provider == "cloudflare" && isUntrustedProviderHeaderEnabled(config) {
+		return
+	}
+
+	l.add(
+		_lintRuleUnverifiedProviderHeader,
+		LintSeverityWarning,
+		"preferredProvider",
+		fmt.Sprintf("the header of %s is used without checking that the peer is an edge of %s, so any client can send it", provider, provider),
+		remediation,
+	)
+}
+
+// unverifiableSpoofingRule warns about the untrustedProviderHeader spoofing rule enabled without trusted networks,
+// as it can then never fire for X-Qrator-IP-Source: Qrator does not publish its edge networks.
+func (l *linter) unverifiableSpoofingRule(config *Config) {
+	if !isUntrustedProviderHeaderEnabled(config) || len(config.TrustedNetworks) > 0 {
+		return
+	}
+
+	l.add(
+		_lintRuleUnverifiableSpoofingRule,
+		LintSeverityWarning,
+		"spoofing.untrustedProviderHeader",
+		"X-Qrator-IP-Source is never reported, as Qrator does not publish its edge networks and no trusted networks are configured",
+		"list your proxies and the networks of your Qrator edge servers in trustedNetworks",
+	)
+}
+
+// isUntrustedProviderHeaderEnabled returns true if the untrustedProviderHeader spoofing rule is enabled.
+func isUntrustedProviderHeaderEnabled(config *Config) bool {
+	return config.Spoofing != nil && config.Spoofing.UntrustedProviderHeader != "" &&
+		config.Spoofing.UntrustedProviderHeader != _spoofingActionOff
+}
+
+// isEveryAddress returns true if the value is a network covering every IPv4 or every IPv6 address.
+func isEveryAddress(value string) bool {
+	prefix, err := netip.ParsePrefix(value)
+	return err == nil && prefix.Bits() == 0
+}
+
+// containsString returns true if the values contain the value.
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
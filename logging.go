@@ -0,0 +1,156 @@
+package traefik_real_ip
+
+import (
+	"fmt"
+	"github.com/darki73/traefik-real-ip/pkg/logger"
+	"github.com/darki73/traefik-real-ip/pkg/providers"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	_loggingOutputStdout = "stdout"
+	_loggingOutputStderr = "stderr"
+)
+
+// LoggingConfig holds the configuration of the structured log written by the plugin.
+type LoggingConfig struct {
+	Level    string `json:"level,omitempty" toml:"level,omitempty" yaml:"level,omitempty"`
+	Format   string `json:"format,omitempty" toml:"format,omitempty" yaml:"format,omitempty"`
+	Output   string `json:"output,omitempty" toml:"output,omitempty" yaml:"output,omitempty"`
+	Sampling int    `json:"sampling,omitempty" toml:"sampling,omitempty" yaml:"sampling,omitempty"`
+}
+
+// CreateLoggingConfig creates the default logging configuration, which only logs suspicious requests and failures.
+func CreateLoggingConfig() *LoggingConfig {
+	return &LoggingConfig{
+		Level:    logger.LevelWarn,
+		Format:   logger.FormatJSON,
+		Output:   _loggingOutputStdout,
+		Sampling: 1,
+	}
+}
+
+// loggingConfig returns the logging configuration with the level overridden by the top-level logLevel option, if set.
+func (config *Config) loggingConfig() *LoggingConfig {
+	if config.LogLevel == "" {
+		return config.Logging
+	}
+
+	logging := CreateLoggingConfig()
+	if config.Logging != nil {
+		*logging = *config.Logging
+	}
+	logging.Level = config.LogLevel
+
+	return logging
+}
+
+// newLogger creates the logger from the logging configuration, filling in the defaults.
+func newLogger(config *LoggingConfig) (*logger.Logger, error) {
+	logging := CreateLoggingConfig()
+
+	if config != nil {
+		if config.Level != "" {
+			logging.Level = config.Level
+		}
+		if config.Format != "" {
+			logging.Format = config.Format
+		}
+		if config.Output != "" {
+			logging.Output = config.Output
+		}
+		if config.Sampling != 0 {
+			logging.Sampling = config.Sampling
+		}
+	}
+
+	var output io.Writer
+	switch logging.Output {
+	case _loggingOutputStdout:
+		output = os.Stdout
+	case _loggingOutputStderr:
+		output = os.Stderr
+	default:
+		return nil, fmt.Errorf(
+			"log output %s is not valid, only the following ones are supported: %s",
+			logging.Output,
+			strings.Join([]string{_loggingOutputStdout, _loggingOutputStderr}, ", "),
+		)
+	}
+
+	return logger.New(logger.Options{
+		Level:    logging.Level,
+		Format:   logging.Format,
+		Output:   output,
+		Sampling: logging.Sampling,
+	})
+}
+
+// logResolution writes the debug message describing how the real IP of the request was determined.
+// Messages are sampled, so busy middlewares do not flood the log.
+func (trip *TraefikRealIP) logResolution(request *http.Request, res *resolution) {
+	if !trip.logger.Enabled(logger.LevelDebug) || !trip.logger.Sample() {
+		return
+	}
+
+	headers := make(map[string]string)
+	var rejected, exceeded, duplicated []string
+
+	for _, result := range res.consulted {
+		for header, value := range result.Values {
+			headers[header] = value
+		}
+		for _, rejection := range result.Rejected {
+			rejected = append(rejected, describeRejection(rejection))
+		}
+		for _, violation := range result.Exceeded {
+			exceeded = append(exceeded, violation.Header+": "+violation.Limit)
+		}
+		duplicated = append(duplicated, result.Duplicated...)
+	}
+
+	fields := []logger.Field{
+		{Key: "name", Value: trip.name},
+		{Key: "peer", Value: request.RemoteAddr},
+		{Key: "trusted", Value: res.trusted},
+		{Key: "headers", Value: headers},
+	}
+
+	if len(rejected) > 0 {
+		fields = append(fields, logger.Field{Key: "rejected", Value: rejected})
+	}
+	if len(exceeded) > 0 {
+		fields = append(fields, logger.Field{Key: "exceeded", Value: exceeded})
+	}
+	if len(duplicated) > 0 {
+		fields = append(fields, logger.Field{Key: "duplicated", Value: duplicated})
+	}
+
+	if res.isResolved() {
+		fields = append(fields,
+			logger.Field{Key: "provider", Value: res.result.Provider},
+			logger.Field{Key: "header", Value: res.result.Header},
+			logger.Field{Key: "ip", Value: res.result.IP.String()},
+		)
+		trip.logger.Log(logger.LevelDebug, "real ip resolved", fields...)
+		return
+	}
+
+	trip.logger.Log(logger.LevelDebug, "real ip not resolved", fields...)
+}
+
+// describeRejection returns the rejected value along with the reason, and the network or parse error which caused it.
+func describeRejection(rejection providers.Rejection) string {
+	description := rejection.Header + ": " + rejection.Value + " " + rejection.Reason
+
+	if rejection.Match.Label != "" {
+		description += " by " + rejection.Match.Label + " " + rejection.Match.Prefix.String()
+	} else if err, ok := rejection.Err.(*providers.AddressError); ok {
+		description += " (" + err.Reason + ")"
+	}
+
+	return description
+}
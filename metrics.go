@@ -0,0 +1,199 @@
+package traefik_real_ip
+
+import (
+	"github.com/darki73/traefik-real-ip/pkg/cidr"
+	"github.com/darki73/traefik-real-ip/pkg/metrics"
+	"github.com/darki73/traefik-real-ip/pkg/resolver"
+	"net/http"
+)
+
+const (
+	_outcomeResolved   = "resolved"
+	_outcomeUnresolved = "unresolved"
+	_outcomeAbsent     = "absent"
+
+	_cacheHit  = "hit"
+	_cacheMiss = "miss"
+)
+
+// MetricsConfig holds the configuration of the metrics endpoint.
+// Metrics are disabled unless path is set, and are only served to loopback peers unless allow is set.
+// Allowed networks are matched against the connection peer, not the real IP, so behind a load balancer
+// allowing its network would expose the metrics to every client.
+type MetricsConfig struct {
+	Path  string   `json:"path,omitempty" toml:"path,omitempty" yaml:"path,omitempty"`
+	Allow []string `json:"allow,omitempty" toml:"allow,omitempty" yaml:"allow,omitempty"`
+}
+
+// CreateMetricsConfig creates the default metrics configuration, with metrics disabled.
+func CreateMetricsConfig() *MetricsConfig {
+	return &MetricsConfig{
+		Path:  "",
+		Allow: []string{"loopback"},
+	}
+}
+
+// resolutionMetrics holds the counters of a middleware, served in the Prometheus text format.
+// A nil value counts nothing.
+type resolutionMetrics struct {
+	name       string
+	path       string
+	allowed    *cidr.Matcher
+	registry   *metrics.Registry
+	requests   *metrics.CounterVec
+	providers  *metrics.CounterVec
+	candidates *metrics.CounterVec
+	spoofing   *metrics.CounterVec
+	rejected   *metrics.CounterVec
+	cache      *metrics.CounterVec
+	audit      *metrics.CounterVec
+}
+
+// newResolutionMetrics creates the counters of the middleware, or returns nil if metrics are disabled.
+func newResolutionMetrics(config *MetricsConfig, name string) (*resolutionMetrics, error) {
+	if config == nil || config.Path == "" {
+		return nil, nil
+	}
+
+	allow := config.Allow
+	if allow == nil {
+		allow = CreateMetricsConfig().Allow
+	}
+
+	allowed, err := resolver.NewMatcher(allow, "metrics.allow")
+	if err != nil {
+		return nil, err
+	}
+
+	registry := metrics.NewRegistry()
+
+	return &resolutionMetrics{
+		name:     name,
+		path:     config.Path,
+		allowed:  allowed,
+		registry: registry,
+		requests: registry.NewCounterVec(
+			"traefik_real_ip_requests_total",
+			"Requests handled by the middleware, by the outcome of the real IP resolution.",
+			"name", "outcome",
+		),
+		providers: registry.NewCounterVec(
+			"traefik_real_ip_provider_results_total",
+			"Results of the consulted providers, absent when the request contained none of the provider headers.",
+			"name", "provider", "outcome",
+		),
+		candidates: registry.NewCounterVec(
+			"traefik_real_ip_rejected_candidates_total",
+			"Header values not accepted as the real IP, by the reason they were rejected.",
+			"name", "provider", "reason",
+		),
+		spoofing: registry.NewCounterVec(
+			"traefik_real_ip_spoofing_suspected_total",
+			"Requests violating a spoofing rule.",
+			"name", "rule",
+		),
+		rejected: registry.NewCounterVec(
+			"traefik_real_ip_rejected_requests_total",
+			"Requests rejected by the middleware, by the reason they were rejected.",
+			"name", "reason",
+		),
+		cache: registry.NewCounterVec(
+			"traefik_real_ip_cache_requests_total",
+			"Lookups of the resolution cache.",
+			"name", "result",
+		),
+		audit: registry.NewCounterVec(
+			"traefik_real_ip_audit_dropped_total",
+			"Audit events dropped because the buffer of the audit sink was full.",
+			"name",
+		),
+	}, nil
+}
+
+// serve writes the metrics if the request is for the metrics path.
+// Peers outside of the allowed networks are refused, as they may not learn about the traffic.
+// It returns false if the request was not for the metrics path and must be handled as usual.
+func (m *resolutionMetrics) serve(responseWriter http.ResponseWriter, request *http.Request) bool {
+	if m == nil || request.URL.Path != m.path {
+		return false
+	}
+
+	ip := resolver.ParsePeerIP(request.RemoteAddr)
+	if !ip.IsValid() || !m.allowed.Contains(ip) {
+		http.Error(responseWriter, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return true
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.registry.Write(responseWriter)
+
+	return true
+}
+
+// observeResolution counts the outcome of the resolution, of every consulted provider and of every rejected candidate.
+func (m *resolutionMetrics) observeResolution(res *resolution) {
+	if m == nil {
+		return
+	}
+
+	if res.isResolved() {
+		m.requests.Inc(m.name, _outcomeResolved)
+	} else {
+		m.requests.Inc(m.name, _outcomeUnresolved)
+	}
+
+	for _, result := range res.consulted {
+		switch {
+		case result.IsResolved():
+			m.providers.Inc(m.name, result.Provider, _outcomeResolved)
+		case result.HasValues():
+			m.providers.Inc(m.name, result.Provider, _outcomeUnresolved)
+		default:
+			m.providers.Inc(m.name, result.Provider, _outcomeAbsent)
+		}
+
+		for _, rejection := range result.Rejected {
+			m.candidates.Inc(m.name, result.Provider, rejection.Reason)
+		}
+	}
+}
+
+// observeSpoofing counts the violated spoofing rule.
+func (m *resolutionMetrics) observeSpoofing(rule string) {
+	if m == nil {
+		return
+	}
+
+	m.spoofing.Inc(m.name, rule)
+}
+
+// observeRejected counts the request rejected for the reason.
+func (m *resolutionMetrics) observeRejected(reason string) {
+	if m == nil {
+		return
+	}
+
+	m.rejected.Inc(m.name, reason)
+}
+
+// observeCache counts the lookup of the resolution cache.
+func (m *resolutionMetrics) observeCache(hit bool) {
+	if m == nil {
+		return
+	}
+
+	if hit {
+		m.cache.Inc(m.name, _cacheHit)
+	} else {
+		m.cache.Inc(m.name, _cacheMiss)
+	}
+}
+
+// observeAuditDropped counts the audit event dropped because the buffer of the audit sink was full.
+func (m *resolutionMetrics) observeAuditDropped() {
+	if m == nil {
+		return
+	}
+
+	m.audit.Inc(m.name)
+}
@@ -0,0 +1,244 @@
+package audit
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBufferSize is the number of events the shared sinks hold while they are being written.
+const DefaultBufferSize = 1024
+
+var (
+	// ErrDropped is returned when the event was dropped because the buffer of the sink is full.
+	ErrDropped = errors.New("audit event dropped, the buffer is full")
+	// ErrClosed is returned when the sink was closed.
+	ErrClosed = errors.New("audit sink is closed")
+)
+
+// _shared holds the sinks opened by OpenFile, OpenSyslog and OpenWriter, by target.
+// Traefik creates the middlewares again on every configuration reload without closing them,
+// so the sinks are shared rather than opened again, which would leak a file descriptor or a socket
+// and make several sinks rotate the same file.
+var _shared = &registry{sinks: make(map[string]*AsyncSink)}
+
+// registry holds the shared sinks by key.
+type registry struct {
+	sinks map[string]*AsyncSink
+	mutex sync.Mutex
+}
+
+// open returns the sink registered under the key, creating it if there is none.
+func (registry *registry) open(key string, create func() (Sink, error)) (*AsyncSink, error) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if sink, ok := registry.sinks[key]; ok {
+		return sink, nil
+	}
+
+	sink, err := create()
+	if err != nil {
+		return nil, err
+	}
+
+	async := NewAsyncSink(sink, DefaultBufferSize)
+	async.target = key
+	async.release = func() {
+		registry.mutex.Lock()
+		defer registry.mutex.Unlock()
+
+		if registry.sinks[key] == async {
+			delete(registry.sinks, key)
+		}
+	}
+	registry.sinks[key] = async
+
+	return async, nil
+}
+
+// OpenFile returns the shared sink of the file at the path, opening the file if no sink writes to it yet.
+// The rotation settings of the latest call apply.
+func OpenFile(path string, maxBytes int64, maxBackups int) (*AsyncSink, error) {
+	async, err := _shared.open("file:"+path, func() (Sink, error) {
+		return NewFileSink(path, maxBytes, maxBackups)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if file, ok := async.sink.(*FileSink); ok {
+		file.SetRotation(maxBytes, maxBackups)
+	}
+
+	return async, nil
+}
+
+// OpenSyslog returns the shared sink of the syslog target and tag, connecting to it if no sink sends to it yet.
+func OpenSyslog(target string, tag string) (*AsyncSink, error) {
+	return _shared.open("syslog:"+target+" "+tag, func() (Sink, error) {
+		return NewSyslogSink(target, tag)
+	})
+}
+
+// OpenWriter returns the shared sink of the writer registered under the name, such as stdout.
+func OpenWriter(name string, writer io.Writer) *AsyncSink {
+	async, _ := _shared.open("writer:"+name, func() (Sink, error) {
+		return NewWriterSink(writer), nil
+	})
+
+	return async
+}
+
+// asyncItem is an event queued for writing, or a flush request if flushed is set.
+type asyncItem struct {
+	event   Event
+	flushed chan struct{}
+}
+
+// AsyncSink writes events to another sink in the background, so a slow file system or syslog server
+// never delays the requests. Events are dropped when the buffer is full.
+type AsyncSink struct {
+	dropped uint64 // first field, so it is 64-bit aligned for the atomic operations on 32-bit platforms
+	sink    Sink
+	target  string
+	queue   chan asyncItem
+	done    chan struct{}
+	closed  bool
+	release func()
+	mutex   sync.RWMutex
+	// handlers holds the error handlers by owner, as a shared sink reports its errors to every user of it.
+	handlers map[string]func(error)
+	// handlerMutex guards handlers apart from mutex, so the background writes never wait for a blocked Write or Flush.
+	handlerMutex sync.Mutex
+}
+
+// NewAsyncSink creates a sink writing to the sink in the background, holding at most size events.
+func NewAsyncSink(sink Sink, size int) *AsyncSink {
+	if size < 1 {
+		size = 1
+	}
+
+	async := &AsyncSink{
+		sink:     sink,
+		queue:    make(chan asyncItem, size),
+		done:     make(chan struct{}),
+		handlers: make(map[string]func(error)),
+	}
+
+	go async.run()
+
+	return async
+}
+
+// Write queues the event, or drops it and returns ErrDropped if the buffer is full.
+func (async *AsyncSink) Write(event Event) error {
+	async.mutex.RLock()
+	defer async.mutex.RUnlock()
+
+	if async.closed {
+		return ErrClosed
+	}
+
+	select {
+	case async.queue <- asyncItem{event: event}:
+		return nil
+	default:
+		atomic.AddUint64(&async.dropped, 1)
+		return ErrDropped
+	}
+}
+
+// Flush waits until the events queued so far are written.
+func (async *AsyncSink) Flush() {
+	async.mutex.RLock()
+	defer async.mutex.RUnlock()
+
+	if async.closed {
+		return
+	}
+
+	flushed := make(chan struct{})
+	async.queue <- asyncItem{flushed: flushed}
+	<-flushed
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (async *AsyncSink) Dropped() uint64 {
+	return atomic.LoadUint64(&async.dropped)
+}
+
+// Target returns the target the shared sink writes to, such as file:/var/log/audit.log, empty if it is not shared.
+func (async *AsyncSink) Target() string {
+	return async.target
+}
+
+// SetErrorHandler sets the function of the owner called with the errors of the background writes,
+// replacing the previous one of the same owner, or removing it if nil. Every handler receives every error,
+// so owners sharing the sink each report them in their own way.
+func (async *AsyncSink) SetErrorHandler(owner string, onError func(error)) {
+	async.handlerMutex.Lock()
+	defer async.handlerMutex.Unlock()
+
+	if onError == nil {
+		delete(async.handlers, owner)
+		return
+	}
+
+	async.handlers[owner] = onError
+}
+
+// Close writes the queued events, closes the underlying sink if it can be closed and stops sharing it.
+func (async *AsyncSink) Close() error {
+	if async.release != nil {
+		async.release()
+	}
+
+	async.mutex.Lock()
+	if async.closed {
+		async.mutex.Unlock()
+		return nil
+	}
+	async.closed = true
+	close(async.queue)
+	async.mutex.Unlock()
+
+	<-async.done
+
+	if closer, ok := async.sink.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// run writes the queued events until the sink is closed.
+func (async *AsyncSink) run() {
+	defer close(async.done)
+
+	for item := range async.queue {
+		if item.flushed != nil {
+			close(item.flushed)
+			continue
+		}
+
+		if err := async.sink.Write(item.event); err != nil {
+			async.reportError(err)
+		}
+	}
+}
+
+// reportError passes the error to every error handler.
+func (async *AsyncSink) reportError(err error) {
+	async.handlerMutex.Lock()
+	handlers := make([]func(error), 0, len(async.handlers))
+	for _, onError := range async.handlers {
+		handlers = append(handlers, onError)
+	}
+	async.handlerMutex.Unlock()
+
+	for _, onError := range handlers {
+		onError(err)
+	}
+}
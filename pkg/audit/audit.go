@@ -0,0 +1,301 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ChangePeer is recorded when the real IP differs from the connection peer address.
+	ChangePeer = "peer"
+	// ChangeRealIP is recorded when the real IP differs from the X-Real-Ip header sent by the client.
+	ChangeRealIP = "real-ip"
+
+	// _syslogPriority is the priority of the messages, facility local0 and severity informational.
+	_syslogPriority = 16*8 + 6
+)
+
+// Event describes a request whose real IP differs from the connection peer or the incoming X-Real-Ip header.
+type Event struct {
+	Time           time.Time `json:"time"`
+	Name           string    `json:"name"`
+	Host           string    `json:"host"`
+	Path           string    `json:"path"`
+	Peer           string    `json:"peer"`
+	IncomingRealIP string    `json:"incomingRealIp,omitempty"`
+	IP             string    `json:"ip"`
+	Provider       string    `json:"provider"`
+	Header         string    `json:"header"`
+	Changes        []string  `json:"changes"`
+}
+
+// Sink records audit events.
+type Sink interface {
+	Write(event Event) error
+}
+
+// encode returns the event as a single line of JSON.
+func encode(event Event) ([]byte, error) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(line, '\n'), nil
+}
+
+// WriterSink writes events as lines of JSON to a writer, such as the standard output.
+type WriterSink struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+// NewWriterSink creates a sink writing to the writer.
+func NewWriterSink(writer io.Writer) *WriterSink {
+	return &WriterSink{writer: writer}
+}
+
+// Write writes the event.
+func (sink *WriterSink) Write(event Event) error {
+	line, err := encode(event)
+	if err != nil {
+		return err
+	}
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	_, err = sink.writer.Write(line)
+
+	return err
+}
+
+// FileSink writes events as lines of JSON to a file, rotating it once it grows over the maximum size.
+// Rotated files are renamed by appending a number, with .1 being the most recent one.
+type FileSink struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	mutex      sync.Mutex
+}
+
+// NewFileSink creates a sink appending to the file at the path.
+// A zero max bytes disables rotation, while max backups is the number of rotated files kept.
+func NewFileSink(path string, maxBytes int64, maxBackups int) (*FileSink, error) {
+	sink := &FileSink{
+		path:       path,
+		maxBytes:   maxBytes,
+		maxBackups: maxBackups,
+	}
+
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// Write writes the event, rotating the file first if the event would not fit into it.
+func (sink *FileSink) Write(event Event) error {
+	line, err := encode(event)
+	if err != nil {
+		return err
+	}
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if sink.maxBytes > 0 && sink.size > 0 && sink.size+int64(len(line)) > sink.maxBytes {
+		if err := sink.rotate(); err != nil {
+			return err
+		}
+	}
+
+	written, err := sink.file.Write(line)
+	sink.size += int64(written)
+
+	return err
+}
+
+// SetRotation changes the size over which the file is rotated and the number of rotated files kept.
+func (sink *FileSink) SetRotation(maxBytes int64, maxBackups int) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	sink.maxBytes = maxBytes
+	sink.maxBackups = maxBackups
+}
+
+// Close closes the file.
+func (sink *FileSink) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	return sink.file.Close()
+}
+
+// open opens the file for appending.
+func (sink *FileSink) open() error {
+	file, err := os.OpenFile(sink.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("unable to open audit file %s: %w", sink.path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("unable to open audit file %s: %w", sink.path, err)
+	}
+
+	sink.file = file
+	sink.size = info.Size()
+
+	return nil
+}
+
+// rotate shifts the rotated files, dropping the oldest one, and starts a new file.
+func (sink *FileSink) rotate() error {
+	if err := sink.file.Close(); err != nil {
+		return err
+	}
+
+	if sink.maxBackups > 0 {
+		_ = os.Remove(sink.backup(sink.maxBackups))
+		for index := sink.maxBackups - 1; index > 0; index-- {
+			_ = os.Rename(sink.backup(index), sink.backup(index+1))
+		}
+		if err := os.Rename(sink.path, sink.backup(1)); err != nil {
+			return fmt.Errorf("unable to rotate audit file %s: %w", sink.path, err)
+		}
+	} else if err := os.Remove(sink.path); err != nil {
+		return fmt.Errorf("unable to rotate audit file %s: %w", sink.path, err)
+	}
+
+	return sink.open()
+}
+
+// backup returns the path of the rotated file with the index.
+func (sink *FileSink) backup(index int) string {
+	return sink.path + "." + strconv.Itoa(index)
+}
+
+// SyslogSink sends events as RFC 5424 messages to a syslog server over UDP or a Unix socket.
+type SyslogSink struct {
+	network  string
+	address  string
+	tag      string
+	hostname string
+	conn     net.Conn
+	mutex    sync.Mutex
+}
+
+// NewSyslogSink creates a sink sending to the target, one of udp://host:port, unix:///path or unixgram:///path.
+func NewSyslogSink(target string, tag string) (*SyslogSink, error) {
+	network, address, err := ParseSyslogTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	sink := &SyslogSink{
+		network:  network,
+		address:  address,
+		tag:      tag,
+		hostname: hostname,
+	}
+
+	if err := sink.connect(); err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// ParseSyslogTarget returns the network and address of the target, one of udp://host:port, unix:///path or unixgram:///path.
+func ParseSyslogTarget(target string) (string, string, error) {
+	network, address, ok := strings.Cut(target, "://")
+	if !ok || address == "" {
+		return "", "", fmt.Errorf("syslog address %s is not valid, it must look like udp://host:port or unix:///path", target)
+	}
+
+	switch network {
+	case "udp", "unix", "unixgram":
+	default:
+		return "", "", fmt.Errorf("syslog network %s is not valid, only the following ones are supported: udp, unix, unixgram", network)
+	}
+
+	return network, address, nil
+}
+
+// Write sends the event, reconnecting once if the connection was lost.
+func (sink *SyslogSink) Write(event Event) error {
+	line, err := encode(event)
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf(
+		"<%d>1 %s %s %s - - - %s",
+		_syslogPriority,
+		event.Time.UTC().Format(time.RFC3339Nano),
+		sink.hostname,
+		sink.tag,
+		line,
+	)
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if sink.conn != nil {
+		if _, err = io.WriteString(sink.conn, message); err == nil {
+			return nil
+		}
+		_ = sink.conn.Close()
+	}
+
+	if err := sink.connect(); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(sink.conn, message)
+
+	return err
+}
+
+// Close closes the connection.
+func (sink *SyslogSink) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if sink.conn == nil {
+		return nil
+	}
+
+	return sink.conn.Close()
+}
+
+// connect opens the connection to the syslog server.
+func (sink *SyslogSink) connect() error {
+	conn, err := net.DialTimeout(sink.network, sink.address, 5*time.Second)
+	if err != nil {
+		sink.conn = nil
+		return fmt.Errorf("unable to connect to syslog %s://%s: %w", sink.network, sink.address, err)
+	}
+
+	sink.conn = conn
+
+	return nil
+}
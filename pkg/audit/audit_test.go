@@ -0,0 +1,234 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEvent(ip string) Event {
+	return Event{
+		Time:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Name:     "real-ip",
+		Host:     "example.com",
+		Path:     "/pay",
+		Peer:     "10.0.0.1:1234",
+		IP:       ip,
+		Provider: "generic",
+		Header:   "X-Forwarded-For",
+		Changes:  []string{ChangePeer},
+	}
+}
+
+func TestWriterSink(framework *testing.T) {
+	var output bytes.Buffer
+	sink := NewWriterSink(&output)
+
+	require.NoError(framework, sink.Write(newTestEvent("1.1.1.1")))
+
+	assert.Equal(framework,
+		`{"time":"2024-01-02T03:04:05Z","name":"real-ip","host":"example.com","path":"/pay","peer":"10.0.0.1:1234",`+
+			`"ip":"1.1.1.1","provider":"generic","header":"X-Forwarded-For","changes":["peer"]}`+"\n",
+		output.String(),
+	)
+}
+
+func TestFileSinkRotation(framework *testing.T) {
+	line, err := encode(newTestEvent("1.1.1.1"))
+	require.NoError(framework, err)
+
+	path := filepath.Join(framework.TempDir(), "audit.log")
+	sink, err := NewFileSink(path, int64(len(line)*2), 2)
+	require.NoError(framework, err)
+	defer sink.Close()
+
+	for _, ip := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4", "5.5.5.5", "6.6.6.6", "7.7.7.7"} {
+		require.NoError(framework, sink.Write(newTestEvent(ip)))
+	}
+
+	expected := map[string][]string{
+		path:        {"7.7.7.7"},
+		path + ".1": {"5.5.5.5", "6.6.6.6"},
+		path + ".2": {"3.3.3.3", "4.4.4.4"},
+	}
+	for file, ips := range expected {
+		content, err := os.ReadFile(file)
+		require.NoError(framework, err)
+
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		require.Len(framework, lines, len(ips), file)
+		for index, ip := range ips {
+			var event Event
+			require.NoError(framework, json.Unmarshal([]byte(lines[index]), &event))
+			assert.Equal(framework, ip, event.IP, file)
+		}
+	}
+
+	_, err = os.Stat(path + ".3")
+	assert.True(framework, os.IsNotExist(err))
+}
+
+func TestFileSinkAppends(framework *testing.T) {
+	path := filepath.Join(framework.TempDir(), "audit.log")
+	require.NoError(framework, os.WriteFile(path, []byte("previous\n"), 0o640))
+
+	sink, err := NewFileSink(path, 0, 0)
+	require.NoError(framework, err)
+	require.NoError(framework, sink.Write(newTestEvent("1.1.1.1")))
+	require.NoError(framework, sink.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(framework, err)
+	assert.True(framework, strings.HasPrefix(string(content), "previous\n{"))
+}
+
+func TestSyslogSink(framework *testing.T) {
+	framework.Run("NewSyslogSink should return an error if an invalid address is passed", func(framework *testing.T) {
+		for _, target := range []string{"", "127.0.0.1:514", "tcp://127.0.0.1:514", "udp://"} {
+			_, err := NewSyslogSink(target, "real-ip")
+			assert.Error(framework, err, target)
+		}
+	})
+
+	framework.Run("Events should be sent over UDP", func(framework *testing.T) {
+		listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(framework, err)
+		defer listener.Close()
+
+		sink, err := NewSyslogSink("udp://"+listener.LocalAddr().String(), "real-ip")
+		require.NoError(framework, err)
+		defer sink.Close()
+
+		require.NoError(framework, sink.Write(newTestEvent("1.1.1.1")))
+
+		assertSyslogMessage(framework, listener)
+	})
+
+	framework.Run("Events should be sent over a Unix datagram socket", func(framework *testing.T) {
+		path := filepath.Join(framework.TempDir(), "log.sock")
+		listener, err := net.ListenPacket("unixgram", path)
+		require.NoError(framework, err)
+		defer listener.Close()
+
+		sink, err := NewSyslogSink("unixgram://"+path, "real-ip")
+		require.NoError(framework, err)
+		defer sink.Close()
+
+		require.NoError(framework, sink.Write(newTestEvent("1.1.1.1")))
+
+		assertSyslogMessage(framework, listener)
+	})
+}
+
+func assertSyslogMessage(framework *testing.T, listener net.PacketConn) {
+	framework.Helper()
+
+	buffer := make([]byte, 2048)
+	require.NoError(framework, listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+	read, _, err := listener.ReadFrom(buffer)
+	require.NoError(framework, err)
+
+	message := string(buffer[:read])
+	assert.True(framework, strings.HasPrefix(message, "<134>1 2024-01-02T03:04:05Z "), message)
+	assert.Contains(framework, message, ` real-ip - - - {"time":"2024-01-02T03:04:05Z"`)
+	assert.Contains(framework, message, `"ip":"1.1.1.1"`)
+}
+
+// blockingSink is a sink whose writes wait until it is released.
+type blockingSink struct {
+	released chan struct{}
+	events   []Event
+}
+
+func (sink *blockingSink) Write(event Event) error {
+	<-sink.released
+	sink.events = append(sink.events, event)
+	return nil
+}
+
+func TestAsyncSink(framework *testing.T) {
+	framework.Run("Events should be written in the background", func(framework *testing.T) {
+		output := &bytes.Buffer{}
+		sink := NewAsyncSink(NewWriterSink(output), 4)
+
+		require.NoError(framework, sink.Write(newTestEvent("1.1.1.1")))
+		sink.Flush()
+
+		assert.Contains(framework, output.String(), `"ip":"1.1.1.1"`)
+		require.NoError(framework, sink.Close())
+	})
+
+	framework.Run("Events should be dropped when the buffer is full", func(framework *testing.T) {
+		blocking := &blockingSink{released: make(chan struct{})}
+		sink := NewAsyncSink(blocking, 1)
+
+		// The first event is taken by the background writer, the second one fills the buffer.
+		require.NoError(framework, sink.Write(newTestEvent("1.1.1.1")))
+		assert.Eventually(framework, func() bool { return len(sink.queue) == 0 }, time.Second, time.Millisecond)
+		require.NoError(framework, sink.Write(newTestEvent("1.1.1.2")))
+
+		assert.ErrorIs(framework, sink.Write(newTestEvent("1.1.1.3")), ErrDropped)
+		assert.Equal(framework, uint64(1), sink.Dropped())
+
+		close(blocking.released)
+		require.NoError(framework, sink.Close())
+		assert.Len(framework, blocking.events, 2)
+		assert.ErrorIs(framework, sink.Write(newTestEvent("1.1.1.4")), ErrClosed)
+	})
+
+	framework.Run("Errors of the background writes should be passed to the error handler", func(framework *testing.T) {
+		path := filepath.Join(framework.TempDir(), "audit.log")
+		file, err := NewFileSink(path, 0, 0)
+		require.NoError(framework, err)
+		require.NoError(framework, file.Close())
+
+		first := make(chan error, 1)
+		second := make(chan error, 1)
+		removed := make(chan error, 1)
+		sink := NewAsyncSink(file, 1)
+		sink.SetErrorHandler("first", func(err error) { first <- err })
+		sink.SetErrorHandler("second", func(err error) { removed <- err })
+		sink.SetErrorHandler("second", func(err error) { second <- err })
+		sink.SetErrorHandler("third", func(err error) { removed <- err })
+		sink.SetErrorHandler("third", nil)
+
+		require.NoError(framework, sink.Write(newTestEvent("1.1.1.1")))
+		sink.Flush()
+
+		assert.Error(framework, <-first)
+		assert.Error(framework, <-second)
+		assert.Empty(framework, removed)
+	})
+}
+
+func TestOpenFile(framework *testing.T) {
+	path := filepath.Join(framework.TempDir(), "audit.log")
+
+	first, err := OpenFile(path, 1024, 1)
+	require.NoError(framework, err)
+	second, err := OpenFile(path, 2048, 2)
+	require.NoError(framework, err)
+
+	assert.Same(framework, first, second)
+	assert.Equal(framework, "file:"+path, first.Target())
+	assert.Equal(framework, int64(2048), first.sink.(*FileSink).maxBytes)
+	assert.Equal(framework, 2, first.sink.(*FileSink).maxBackups)
+
+	require.NoError(framework, first.Close())
+
+	third, err := OpenFile(path, 1024, 1)
+	require.NoError(framework, err)
+	assert.NotSame(framework, first, third)
+	require.NoError(framework, third.Close())
+
+	_, err = OpenFile(filepath.Join(framework.TempDir(), "missing", "audit.log"), 0, 0)
+	assert.Error(framework, err)
+}
@@ -0,0 +1,180 @@
+package cidr
+
+import (
+	"net/netip"
+)
+
+// Entry is a network stored in the matcher, along with the label of the list it came from.
+type Entry struct {
+	Prefix netip.Prefix
+	Label  string
+}
+
+// Matcher matches IP addresses against a set of networks using a path-compressed binary radix tree.
+// IPv4 and IPv6 networks are kept in separate trees. A nil matcher matches nothing.
+// Matcher is safe for concurrent lookups once it is no longer modified.
+type Matcher struct {
+	ipv4 *node
+	ipv6 *node
+	size int
+}
+
+// node is a node of the radix tree, entry is nil for nodes which only exist to branch.
+type node struct {
+	prefix   netip.Prefix
+	entry    *Entry
+	children [2]*node
+}
+
+// NewMatcher creates an empty matcher.
+func NewMatcher() *Matcher {
+	return &Matcher{}
+}
+
+// Insert adds the network to the matcher under the given label.
+// When the same network is inserted more than once, the first label is kept.
+func (matcher *Matcher) Insert(prefix netip.Prefix, label string) {
+	prefix = prefix.Masked()
+	if !prefix.IsValid() {
+		return
+	}
+
+	root := &matcher.ipv6
+	if prefix.Addr().Is4() {
+		root = &matcher.ipv4
+	}
+
+	if insert(root, &Entry{Prefix: prefix, Label: label}) {
+		matcher.size++
+	}
+}
+
+// InsertAll adds every network to the matcher under the given label.
+func (matcher *Matcher) InsertAll(prefixes []netip.Prefix, label string) {
+	for _, prefix := range prefixes {
+		matcher.Insert(prefix, label)
+	}
+}
+
+// InsertAddr adds the single address to the matcher under the given label.
+func (matcher *Matcher) InsertAddr(ip netip.Addr, label string) {
+	matcher.Insert(netip.PrefixFrom(ip, ip.BitLen()), label)
+}
+
+// Lookup returns the most specific network containing the address.
+func (matcher *Matcher) Lookup(ip netip.Addr) (Entry, bool) {
+	if matcher == nil || !ip.IsValid() {
+		return Entry{}, false
+	}
+
+	current := matcher.ipv6
+	if ip.Is4() {
+		current = matcher.ipv4
+	}
+
+	var best *Entry
+
+	for current != nil && current.prefix.Contains(ip) {
+		if current.entry != nil {
+			best = current.entry
+		}
+		if current.prefix.Bits() == ip.BitLen() {
+			break
+		}
+		current = current.children[bitAt(ip, current.prefix.Bits())]
+	}
+
+	if best == nil {
+		return Entry{}, false
+	}
+
+	return *best, true
+}
+
+// Contains returns true if any of the networks contains the address.
+func (matcher *Matcher) Contains(ip netip.Addr) bool {
+	_, ok := matcher.Lookup(ip)
+	return ok
+}
+
+// Len returns the number of networks in the matcher.
+func (matcher *Matcher) Len() int {
+	if matcher == nil {
+		return 0
+	}
+
+	return matcher.size
+}
+
+// insert adds the entry to the tree, returning false if the network was already present.
+func insert(root **node, entry *Entry) bool {
+	current := *root
+	if current == nil {
+		*root = &node{prefix: entry.Prefix, entry: entry}
+		return true
+	}
+
+	common := commonBits(current.prefix, entry.Prefix)
+
+	if common == current.prefix.Bits() && common == entry.Prefix.Bits() {
+		if current.entry != nil {
+			return false
+		}
+		current.entry = entry
+		return true
+	}
+
+	if common == current.prefix.Bits() {
+		return insert(&current.children[bitAt(entry.Prefix.Addr(), common)], entry)
+	}
+
+	split := &node{prefix: netip.PrefixFrom(entry.Prefix.Addr(), common).Masked()}
+	split.children[bitAt(current.prefix.Addr(), common)] = current
+
+	if common == entry.Prefix.Bits() {
+		split.entry = entry
+	} else {
+		split.children[bitAt(entry.Prefix.Addr(), common)] = &node{prefix: entry.Prefix, entry: entry}
+	}
+
+	*root = split
+
+	return true
+}
+
+// commonBits returns the length of the prefix shared by both networks.
+func commonBits(first netip.Prefix, second netip.Prefix) int {
+	limit := first.Bits()
+	if second.Bits() < limit {
+		limit = second.Bits()
+	}
+
+	firstBytes := first.Addr().As16()
+	secondBytes := second.Addr().As16()
+	offset := 0
+	if first.Addr().Is4() {
+		offset = 96
+	}
+
+	bits := 0
+	for bits < limit && bitOf(firstBytes, offset+bits) == bitOf(secondBytes, offset+bits) {
+		bits++
+	}
+
+	return bits
+}
+
+// bitAt returns the bit of the address at the given position, counting from the most significant one.
+func bitAt(ip netip.Addr, position int) int {
+	offset := 0
+	if ip.Is4() {
+		offset = 96
+	}
+
+	return bitOf(ip.As16(), offset+position)
+}
+
+// bitOf returns the bit of the 16 byte address at the given position.
+func bitOf(bytes [16]byte, position int) int {
+	return int(bytes[position/8]>>(7-uint(position%8))) & 1
+}
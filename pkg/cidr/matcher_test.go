@@ -0,0 +1,154 @@
+package cidr
+
+import (
+	"math/rand"
+	"net/netip"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatcherLookup(framework *testing.T) {
+	matcher := NewMatcher()
+	matcher.Insert(netip.MustParsePrefix("10.0.0.0/8"), "private")
+	matcher.Insert(netip.MustParsePrefix("10.1.0.0/16"), "internal")
+	matcher.Insert(netip.MustParsePrefix("10.1.2.0/24"), "lb")
+	matcher.Insert(netip.MustParsePrefix("192.168.0.0/16"), "private")
+	matcher.Insert(netip.MustParsePrefix("2001:db8::/32"), "documentation")
+	matcher.Insert(netip.MustParsePrefix("2001:db8:1::/48"), "office")
+	matcher.InsertAddr(netip.MustParseAddr("8.8.8.8"), "address")
+	matcher.Insert(netip.MustParsePrefix("10.0.0.0/8"), "duplicate")
+
+	testCases := []struct {
+		description   string
+		ip            string
+		expectedOK    bool
+		expectedLabel string
+		expectedCIDR  string
+	}{
+		{description: "Address outside of every network should not match", ip: "11.0.0.1"},
+		{description: "Address should match the only containing network", ip: "10.200.0.1", expectedOK: true, expectedLabel: "private", expectedCIDR: "10.0.0.0/8"},
+		{description: "Address should match the most specific network", ip: "10.1.2.3", expectedOK: true, expectedLabel: "lb", expectedCIDR: "10.1.2.0/24"},
+		{description: "Address should match the intermediate network", ip: "10.1.3.3", expectedOK: true, expectedLabel: "internal", expectedCIDR: "10.1.0.0/16"},
+		{description: "Single address should match exactly", ip: "8.8.8.8", expectedOK: true, expectedLabel: "address", expectedCIDR: "8.8.8.8/32"},
+		{description: "Neighbour of a single address should not match", ip: "8.8.8.9"},
+		{description: "IPv6 address should match the most specific network", ip: "2001:db8:1::1", expectedOK: true, expectedLabel: "office", expectedCIDR: "2001:db8:1::/48"},
+		{description: "IPv6 address should match the containing network", ip: "2001:db8:2::1", expectedOK: true, expectedLabel: "documentation", expectedCIDR: "2001:db8::/32"},
+		{description: "IPv4-mapped IPv6 address should not match IPv4 networks", ip: "::ffff:10.0.0.1"},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			entry, ok := matcher.Lookup(netip.MustParseAddr(test.ip))
+
+			assert.Equal(framework, test.expectedOK, ok)
+			if test.expectedOK {
+				assert.Equal(framework, test.expectedLabel, entry.Label)
+				assert.Equal(framework, test.expectedCIDR, entry.Prefix.String())
+			}
+		})
+	}
+
+	assert.Equal(framework, 7, matcher.Len())
+}
+
+func TestMatcherAgainstLinearScan(framework *testing.T) {
+	prefixes := randomPrefixes(2000)
+	matcher := NewMatcher()
+	matcher.InsertAll(prefixes, "random")
+
+	random := rand.New(rand.NewSource(2))
+	for index := 0; index < 10000; index++ {
+		ip := randomAddr(random)
+		assert.Equal(framework, linearContains(prefixes, ip), matcher.Contains(ip), ip.String())
+	}
+}
+
+func TestNilMatcher(framework *testing.T) {
+	var matcher *Matcher
+
+	assert.False(framework, matcher.Contains(netip.MustParseAddr("10.0.0.1")))
+	assert.Equal(framework, 0, matcher.Len())
+}
+
+func BenchmarkMatcherContains(benchmark *testing.B) {
+	for _, size := range []int{3, 1000, 10000} {
+		prefixes := randomPrefixes(size)
+		matcher := NewMatcher()
+		matcher.InsertAll(prefixes, "random")
+		addresses := randomAddrs(1024)
+
+		benchmark.Run(strconv.Itoa(size), func(benchmark *testing.B) {
+			benchmark.ReportAllocs()
+			for index := 0; index < benchmark.N; index++ {
+				matcher.Contains(addresses[index%len(addresses)])
+			}
+		})
+	}
+}
+
+func BenchmarkLinearContains(benchmark *testing.B) {
+	for _, size := range []int{3, 1000, 10000} {
+		prefixes := randomPrefixes(size)
+		addresses := randomAddrs(1024)
+
+		benchmark.Run(strconv.Itoa(size), func(benchmark *testing.B) {
+			benchmark.ReportAllocs()
+			for index := 0; index < benchmark.N; index++ {
+				linearContains(prefixes, addresses[index%len(addresses)])
+			}
+		})
+	}
+}
+
+// linearContains is the linear scan the matcher replaces.
+func linearContains(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// randomPrefixes returns a deterministic mix of IPv4 and IPv6 networks.
+func randomPrefixes(count int) []netip.Prefix {
+	random := rand.New(rand.NewSource(1))
+	prefixes := make([]netip.Prefix, 0, count)
+
+	for index := 0; index < count; index++ {
+		ip := randomAddr(random)
+		bits := 8 + random.Intn(ip.BitLen()-7)
+		prefixes = append(prefixes, netip.PrefixFrom(ip, bits).Masked())
+	}
+
+	return prefixes
+}
+
+// randomAddrs returns a deterministic mix of IPv4 and IPv6 addresses.
+func randomAddrs(count int) []netip.Addr {
+	random := rand.New(rand.NewSource(3))
+	addresses := make([]netip.Addr, 0, count)
+
+	for index := 0; index < count; index++ {
+		addresses = append(addresses, randomAddr(random))
+	}
+
+	return addresses
+}
+
+// randomAddr returns a random IPv4 address, or an IPv6 address in a third of the cases.
+func randomAddr(random *rand.Rand) netip.Addr {
+	if random.Intn(3) == 0 {
+		var bytes [16]byte
+		random.Read(bytes[:])
+		bytes[0] = 0x20
+		return netip.AddrFrom16(bytes)
+	}
+
+	var bytes [4]byte
+	random.Read(bytes[:])
+	return netip.AddrFrom4(bytes)
+}
@@ -0,0 +1,239 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// LevelDebug is the level of the messages describing every decision made.
+	LevelDebug = "debug"
+	// LevelInfo is the level of the messages describing notable events.
+	LevelInfo = "info"
+	// LevelWarn is the level of the messages describing suspicious requests.
+	LevelWarn = "warn"
+	// LevelError is the level of the messages describing failures.
+	LevelError = "error"
+	// LevelOff disables logging.
+	LevelOff = "off"
+
+	// FormatJSON writes every message as a JSON object.
+	FormatJSON = "json"
+	// FormatLogfmt writes every message as key=value pairs.
+	FormatLogfmt = "logfmt"
+)
+
+// _levels holds the severity of every level, messages below the configured severity are not written.
+var _levels = map[string]int{
+	LevelDebug: 0,
+	LevelInfo:  1,
+	LevelWarn:  2,
+	LevelError: 3,
+	LevelOff:   4,
+}
+
+// Field is a key => value pair attached to a message.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Options holds the configuration of the logger.
+type Options struct {
+	// Level is the minimum level of the written messages, one of the Level* constants.
+	Level string
+	// Format is the format of the written messages, one of the Format* constants.
+	Format string
+	// Output is the writer the messages are written to.
+	Output io.Writer
+	// Sampling is the rate of sampled messages, one out of every sampling messages is written.
+	Sampling int
+}
+
+// Logger writes structured messages, one per line.
+// A nil logger writes nothing.
+type Logger struct {
+	level    int
+	format   string
+	output   io.Writer
+	sampling uint64
+	counter  uint64
+	now      func() time.Time
+	mutex    sync.Mutex
+}
+
+// New creates a logger with the given options.
+func New(options Options) (*Logger, error) {
+	level, ok := _levels[options.Level]
+	if !ok {
+		return nil, fmt.Errorf(
+			"log level %s is not valid, only the following ones are supported: %s",
+			options.Level,
+			strings.Join([]string{LevelDebug, LevelInfo, LevelWarn, LevelError, LevelOff}, ", "),
+		)
+	}
+
+	if options.Format != FormatJSON && options.Format != FormatLogfmt {
+		return nil, fmt.Errorf(
+			"log format %s is not valid, only the following ones are supported: %s",
+			options.Format,
+			strings.Join([]string{FormatJSON, FormatLogfmt}, ", "),
+		)
+	}
+
+	if options.Sampling < 0 {
+		return nil, fmt.Errorf("log sampling %d is not valid, it must not be negative", options.Sampling)
+	}
+
+	sampling := options.Sampling
+	if sampling == 0 {
+		sampling = 1
+	}
+
+	return &Logger{
+		level:    level,
+		format:   options.Format,
+		output:   options.Output,
+		sampling: uint64(sampling),
+		now:      time.Now,
+	}, nil
+}
+
+// Enabled returns true if messages of the level are written.
+func (logger *Logger) Enabled(level string) bool {
+	if logger == nil {
+		return false
+	}
+
+	severity, ok := _levels[level]
+
+	return ok && severity < _levels[LevelOff] && severity >= logger.level
+}
+
+// Sample returns true for one out of every sampling calls, and should guard messages which may flood the output.
+func (logger *Logger) Sample() bool {
+	if logger == nil {
+		return false
+	}
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.counter++
+
+	return (logger.counter-1)%logger.sampling == 0
+}
+
+// Log writes the message with the fields, if the level is enabled.
+func (logger *Logger) Log(level string, message string, fields ...Field) {
+	if !logger.Enabled(level) {
+		return
+	}
+
+	all := make([]Field, 0, len(fields)+3)
+	all = append(all, Field{"time", logger.now().UTC().Format(time.RFC3339Nano)}, Field{"level", level}, Field{"msg", message})
+	all = append(all, fields...)
+
+	var line string
+	if logger.format == FormatJSON {
+		line = encodeJSON(all)
+	} else {
+		line = encodeLogfmt(all)
+	}
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	_, _ = io.WriteString(logger.output, line+"\n")
+}
+
+// encodeJSON returns the fields as a JSON object, keeping their order.
+func encodeJSON(fields []Field) string {
+	var builder strings.Builder
+	builder.WriteByte('{')
+
+	for index, field := range fields {
+		if index > 0 {
+			builder.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.Key)
+		builder.Write(key)
+		builder.WriteByte(':')
+		builder.WriteString(encodeJSONValue(field.Value))
+	}
+
+	builder.WriteByte('}')
+
+	return builder.String()
+}
+
+// encodeJSONValue returns the value encoded as JSON, values which can not be encoded are written as strings.
+func encodeJSONValue(value interface{}) string {
+	if stringer, ok := value.(fmt.Stringer); ok {
+		value = stringer.String()
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+
+	return string(encoded)
+}
+
+// encodeLogfmt returns the fields as key=value pairs, keeping their order.
+func encodeLogfmt(fields []Field) string {
+	var builder strings.Builder
+
+	for index, field := range fields {
+		if index > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(field.Key)
+		builder.WriteByte('=')
+		builder.WriteString(quoteLogfmt(encodeLogfmtValue(field.Value)))
+	}
+
+	return builder.String()
+}
+
+// encodeLogfmtValue returns the value as text, lists and maps are written as comma separated elements.
+func encodeLogfmtValue(value interface{}) string {
+	switch typed := value.(type) {
+	case string:
+		return typed
+	case fmt.Stringer:
+		return typed.String()
+	case []string:
+		return strings.Join(typed, ",")
+	case map[string]string:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		pairs := make([]string, 0, len(keys))
+		for _, key := range keys {
+			pairs = append(pairs, key+"="+typed[key])
+		}
+		return strings.Join(pairs, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// quoteLogfmt quotes the value if it contains spaces, quotes or equal signs.
+func quoteLogfmt(value string) string {
+	if value == "" || strings.ContainsAny(value, " \"=\t\r\n\\") {
+		return strconv.Quote(value)
+	}
+
+	return value
+}
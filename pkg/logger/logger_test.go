@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"bytes"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(framework *testing.T) {
+	testCases := []struct {
+		description   string
+		options       Options
+		expectedError bool
+	}{
+		{"New should accept a valid configuration", Options{Level: LevelDebug, Format: FormatJSON}, false},
+		{"New should return an error if an invalid level is passed", Options{Level: "trace", Format: FormatJSON}, true},
+		{"New should return an error if an invalid format is passed", Options{Level: LevelInfo, Format: "text"}, true},
+		{"New should return an error if a negative sampling is passed", Options{Level: LevelInfo, Format: FormatLogfmt, Sampling: -1}, true},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			_, err := New(test.options)
+			if test.expectedError {
+				assert.Error(framework, err)
+			} else {
+				assert.NoError(framework, err)
+			}
+		})
+	}
+}
+
+func TestLog(framework *testing.T) {
+	fields := []Field{
+		{Key: "name", Value: "real-ip"},
+		{Key: "ip", Value: netip.MustParseAddr("1.1.1.1")},
+		{Key: "trusted", Value: true},
+		{Key: "rejected", Value: []string{"X-Forwarded-For: 10.0.0.1 excluded"}},
+		{Key: "headers", Value: map[string]string{"X-Real-Ip": "1.1.1.1", "X-Forwarded-For": "10.0.0.1, 1.1.1.1"}},
+	}
+
+	testCases := []struct {
+		description string
+		format      string
+		expected    string
+	}{
+		{
+			description: "JSON messages should keep the order of the fields",
+			format:      FormatJSON,
+			expected: `{"time":"2024-01-02T03:04:05Z","level":"info","msg":"real ip resolved","name":"real-ip","ip":"1.1.1.1","trusted":true,` +
+				`"rejected":["X-Forwarded-For: 10.0.0.1 excluded"],"headers":{"X-Forwarded-For":"10.0.0.1, 1.1.1.1","X-Real-Ip":"1.1.1.1"}}`,
+		},
+		{
+			description: "Logfmt messages should quote values with spaces",
+			format:      FormatLogfmt,
+			expected: `time=2024-01-02T03:04:05Z level=info msg="real ip resolved" name=real-ip ip=1.1.1.1 trusted=true ` +
+				`rejected="X-Forwarded-For: 10.0.0.1 excluded" headers="X-Forwarded-For=10.0.0.1, 1.1.1.1,X-Real-Ip=1.1.1.1"`,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			var output bytes.Buffer
+			logger, err := New(Options{Level: LevelInfo, Format: test.format, Output: &output})
+			require.NoError(framework, err)
+			logger.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+			logger.Log(LevelInfo, "real ip resolved", fields...)
+
+			assert.Equal(framework, test.expected+"\n", output.String())
+		})
+	}
+}
+
+func TestLevels(framework *testing.T) {
+	var output bytes.Buffer
+	logger, err := New(Options{Level: LevelWarn, Format: FormatLogfmt, Output: &output})
+	require.NoError(framework, err)
+
+	logger.Log(LevelDebug, "debug")
+	logger.Log(LevelInfo, "info")
+	logger.Log(LevelWarn, "warn")
+	logger.Log(LevelError, "error")
+	logger.Log(LevelOff, "off")
+
+	assert.Equal(framework, 2, strings.Count(output.String(), "\n"))
+	assert.Contains(framework, output.String(), "msg=warn")
+	assert.Contains(framework, output.String(), "msg=error")
+
+	var disabled *Logger
+	assert.False(framework, disabled.Enabled(LevelError))
+	assert.False(framework, disabled.Sample())
+	disabled.Log(LevelError, "error")
+}
+
+func TestSample(framework *testing.T) {
+	logger, err := New(Options{Level: LevelDebug, Format: FormatJSON, Sampling: 3})
+	require.NoError(framework, err)
+
+	sampled := 0
+	for index := 0; index < 9; index++ {
+		if logger.Sample() {
+			sampled++
+		}
+	}
+
+	assert.Equal(framework, 3, sampled)
+}
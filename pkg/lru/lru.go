@@ -0,0 +1,71 @@
+package lru
+
+import (
+	"container/list"
+)
+
+// Cache is a fixed size cache which evicts the least recently used entries.
+// It is not safe for concurrent use, callers are expected to synchronize access.
+type Cache struct {
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+// entry is the key => value pair stored in the cache.
+type entry struct {
+	key   string
+	value interface{}
+}
+
+// New creates a cache holding at most capacity entries.
+func New(capacity int) *Cache {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &Cache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// Get returns the value stored under the key and marks it as recently used.
+func (cache *Cache) Get(key string) (interface{}, bool) {
+	element, ok := cache.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	cache.order.MoveToFront(element)
+
+	return element.Value.(*entry).value, true
+}
+
+// Add stores the value under the key, evicting the least recently used entry if the cache is full.
+func (cache *Cache) Add(key string, value interface{}) {
+	if element, ok := cache.items[key]; ok {
+		element.Value.(*entry).value = value
+		cache.order.MoveToFront(element)
+		return
+	}
+
+	if cache.order.Len() >= cache.capacity {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.items, oldest.Value.(*entry).key)
+	}
+
+	cache.items[key] = cache.order.PushFront(&entry{key: key, value: value})
+}
+
+// Len returns the number of entries in the cache.
+func (cache *Cache) Len() int {
+	return cache.order.Len()
+}
+
+// GetCapacity returns the maximum number of entries in the cache.
+func (cache *Cache) GetCapacity() int {
+	return cache.capacity
+}
@@ -0,0 +1,63 @@
+package lru
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(framework *testing.T) {
+	framework.Run("Values should be returned under their key", func(framework *testing.T) {
+		cache := New(2)
+		cache.Add("first", 1)
+
+		value, ok := cache.Get("first")
+		assert.True(framework, ok)
+		assert.Equal(framework, 1, value)
+
+		_, ok = cache.Get("missing")
+		assert.False(framework, ok)
+	})
+
+	framework.Run("Least recently used entry should be evicted when the cache is full", func(framework *testing.T) {
+		cache := New(2)
+		cache.Add("first", 1)
+		cache.Add("second", 2)
+		cache.Get("first")
+		cache.Add("third", 3)
+
+		_, ok := cache.Get("second")
+		assert.False(framework, ok)
+		_, ok = cache.Get("first")
+		assert.True(framework, ok)
+		_, ok = cache.Get("third")
+		assert.True(framework, ok)
+		assert.Equal(framework, 2, cache.Len())
+	})
+
+	framework.Run("Adding an existing key should replace its value and mark it as recently used", func(framework *testing.T) {
+		cache := New(2)
+		cache.Add("first", 1)
+		cache.Add("second", 2)
+		cache.Add("first", 10)
+		cache.Add("third", 3)
+
+		value, ok := cache.Get("first")
+		assert.True(framework, ok)
+		assert.Equal(framework, 10, value)
+		_, ok = cache.Get("second")
+		assert.False(framework, ok)
+		assert.Equal(framework, 2, cache.Len())
+	})
+
+	framework.Run("Capacity should be at least one", func(framework *testing.T) {
+		for _, capacity := range []int{0, -1} {
+			cache := New(capacity)
+			cache.Add("first", 1)
+			cache.Add("second", 2)
+
+			assert.Equal(framework, 1, cache.GetCapacity())
+			assert.Equal(framework, 1, cache.Len())
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds counters and writes them in the Prometheus text exposition format.
+type Registry struct {
+	counters []*CounterVec
+	mutex    sync.Mutex
+}
+
+// CounterVec is a family of counters sharing a name and label names, partitioned by label values.
+// A nil counter family counts nothing.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	values map[string]*counter
+	mutex  sync.Mutex
+}
+
+// counter is a single counter of the family.
+type counter struct {
+	labelValues []string
+	value       uint64
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// NewCounterVec creates a counter family and registers it, families are written in registration order.
+func (registry *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	vec := &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]*counter),
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.counters = append(registry.counters, vec)
+
+	return vec
+}
+
+// Inc increments the counter with the label values, which must be given in the order of the label names.
+func (vec *CounterVec) Inc(labelValues ...string) {
+	vec.Add(1, labelValues...)
+}
+
+// Add adds the delta to the counter with the label values, which must be given in the order of the label names.
+func (vec *CounterVec) Add(delta uint64, labelValues ...string) {
+	if vec == nil {
+		return
+	}
+
+	if len(labelValues) != len(vec.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", vec.name, len(vec.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	vec.mutex.Lock()
+	defer vec.mutex.Unlock()
+
+	current, ok := vec.values[key]
+	if !ok {
+		current = &counter{labelValues: append([]string(nil), labelValues...)}
+		vec.values[key] = current
+	}
+
+	current.value += delta
+}
+
+// Value returns the value of the counter with the label values, zero if it was never incremented.
+func (vec *CounterVec) Value(labelValues ...string) uint64 {
+	if vec == nil {
+		return 0
+	}
+
+	vec.mutex.Lock()
+	defer vec.mutex.Unlock()
+
+	if current, ok := vec.values[strings.Join(labelValues, "\xff")]; ok {
+		return current.value
+	}
+
+	return 0
+}
+
+// Write writes every counter of the registry in the Prometheus text exposition format.
+// Counters of a family are sorted by their label values, so the output is stable.
+func (registry *Registry) Write(writer io.Writer) error {
+	registry.mutex.Lock()
+	counters := append([]*CounterVec(nil), registry.counters...)
+	registry.mutex.Unlock()
+
+	var builder strings.Builder
+	for _, vec := range counters {
+		vec.write(&builder)
+	}
+
+	_, err := io.WriteString(writer, builder.String())
+
+	return err
+}
+
+// write writes the counter family to the builder.
+func (vec *CounterVec) write(builder *strings.Builder) {
+	vec.mutex.Lock()
+	defer vec.mutex.Unlock()
+
+	builder.WriteString("# HELP " + vec.name + " " + escapeHelp(vec.help) + "\n")
+	builder.WriteString("# TYPE " + vec.name + " counter\n")
+
+	keys := make([]string, 0, len(vec.values))
+	for key := range vec.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		current := vec.values[key]
+
+		builder.WriteString(vec.name)
+		if len(vec.labels) > 0 {
+			builder.WriteByte('{')
+			for index, label := range vec.labels {
+				if index > 0 {
+					builder.WriteByte(',')
+				}
+				builder.WriteString(label + "=\"" + escapeLabelValue(current.labelValues[index]) + "\"")
+			}
+			builder.WriteByte('}')
+		}
+		builder.WriteString(" " + strconv.FormatUint(current.value, 10) + "\n")
+	}
+}
+
+// escapeHelp escapes backslashes and line feeds of the help text.
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// escapeLabelValue escapes backslashes, double quotes and line feeds of the label value.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
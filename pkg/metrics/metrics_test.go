@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryWrite(framework *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounterVec("requests_total", "Requests handled.", "name", "outcome")
+	spoofing := registry.NewCounterVec("spoofing_total", "Spoofing \\ suspected.\nPer rule.", "rule")
+	registry.NewCounterVec("empty_total", "Never incremented.")
+
+	requests.Inc("real-ip", "unresolved")
+	requests.Inc("real-ip", "resolved")
+	requests.Add(2, "real-ip", "resolved")
+	spoofing.Inc("quote \" backslash \\ newline \n")
+
+	var output bytes.Buffer
+	require.NoError(framework, registry.Write(&output))
+
+	expected := `# HELP requests_total Requests handled.
+# TYPE requests_total counter
+requests_total{name="real-ip",outcome="resolved"} 3
+requests_total{name="real-ip",outcome="unresolved"} 1
+# HELP spoofing_total Spoofing \\ suspected.\nPer rule.
+# TYPE spoofing_total counter
+spoofing_total{rule="quote \" backslash \\ newline \n"} 1
+# HELP empty_total Never incremented.
+# TYPE empty_total counter
+`
+	assert.Equal(framework, expected, output.String())
+	assert.Equal(framework, uint64(3), requests.Value("real-ip", "resolved"))
+	assert.Equal(framework, uint64(0), requests.Value("real-ip", "absent"))
+}
+
+func TestCounterVecLabels(framework *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounterVec("requests_total", "Requests handled.", "name", "outcome")
+
+	assert.Panics(framework, func() { requests.Inc("real-ip") })
+
+	var disabled *CounterVec
+	assert.NotPanics(framework, func() { disabled.Inc("real-ip") })
+	assert.Equal(framework, uint64(0), disabled.Value("real-ip"))
+}
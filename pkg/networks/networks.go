@@ -0,0 +1,150 @@
+package networks
+
+import (
+	"net/netip"
+	"sort"
+)
+
+// _sets holds the built-in named network sets, which can be used wherever networks in CIDR notation are accepted.
+var _sets = map[string][]string{
+	"private": {
+		"10.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"fc00::/7",
+	},
+	"loopback": {
+		"127.0.0.0/8",
+		"::1/128",
+	},
+	"linklocal": {
+		"169.254.0.0/16",
+		"fe80::/10",
+	},
+	"cgnat": {
+		"100.64.0.0/10",
+	},
+	// Special-purpose networks which never carry public client traffic (RFC 6890 and RFC 5737).
+	"bogon": {
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.0.2.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"198.51.100.0/24",
+		"203.0.113.0/24",
+		"224.0.0.0/4",
+		"240.0.0.0/4",
+		"::/128",
+		"::1/128",
+		"100::/64",
+		"2001:10::/28",
+		"2001:db8::/32",
+		"fc00::/7",
+		"fe80::/10",
+		"fec0::/10",
+		"ff00::/8",
+	},
+	// Addresses meaning "this host" or "no address".
+	"unspecified": {
+		"0.0.0.0/8",
+		"::/128",
+	},
+	// Limited broadcast address.
+	"broadcast": {
+		"255.255.255.255/32",
+	},
+	"multicast": {
+		"224.0.0.0/4",
+		"ff00::/8",
+	},
+	// Networks reserved for documentation and examples (RFC 5737 and RFC 3849).
+	"documentation": {
+		"192.0.2.0/24",
+		"198.51.100.0/24",
+		"203.0.113.0/24",
+		"2001:db8::/32",
+	},
+	// Networks reserved for future use, benchmarking and discard (RFC 1112, RFC 2544 and RFC 6666).
+	"reserved": {
+		"240.0.0.0/4",
+		"198.18.0.0/15",
+		"100::/64",
+	},
+	// Networks Cloudflare edge servers connect from, as published on https://www.cloudflare.com/ips/.
+	"cloudflare": {
+		"173.245.48.0/20",
+		"103.21.244.0/22",
+		"103.22.200.0/22",
+		"103.31.4.0/22",
+		"141.101.64.0/18",
+		"108.162.192.0/18",
+		"190.93.240.0/20",
+		"188.114.96.0/20",
+		"197.234.240.0/22",
+		"198.41.128.0/17",
+		"162.158.0.0/15",
+		"104.16.0.0/13",
+		"104.24.0.0/14",
+		"172.64.0.0/13",
+		"131.0.72.0/22",
+		"2400:cb00::/32",
+		"2606:4700::/32",
+		"2803:f800::/32",
+		"2405:b500::/32",
+		"2405:8100::/32",
+		"2a06:98c0::/29",
+		"2c0f:f248::/32",
+	},
+	// Default address pools of the Docker bridge networks.
+	"docker-default": {
+		"172.17.0.0/16",
+		"172.18.0.0/15",
+		"172.20.0.0/14",
+		"172.24.0.0/13",
+		"192.168.0.0/16",
+	},
+	// Default pod and service networks of kubeadm with Flannel, and of k3s.
+	"kubernetes-default": {
+		"10.96.0.0/12",
+		"10.244.0.0/16",
+		"10.42.0.0/16",
+		"10.43.0.0/16",
+	},
+}
+
+// Lookup returns the networks of the named set.
+func Lookup(name string) ([]netip.Prefix, bool) {
+	values, ok := _sets[name]
+	if !ok {
+		return nil, false
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		prefixes = append(prefixes, netip.MustParsePrefix(value))
+	}
+
+	return prefixes, true
+}
+
+// IsNamedSet returns true if the name refers to a built-in network set.
+func IsNamedSet(name string) bool {
+	_, ok := _sets[name]
+	return ok
+}
+
+// Names returns the names of the built-in network sets in alphabetical order.
+func Names() []string {
+	names := make([]string, 0, len(_sets))
+	for name := range _sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,149 @@
+package networks
+
+import (
+	"net/netip"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsNamedSet(framework *testing.T) {
+	framework.Parallel()
+
+	testCases := []struct {
+		description string
+		name        string
+		expected    bool
+	}{
+		{
+			description: "Built-in set should be recognized",
+			name:        "private",
+			expected:    true,
+		},
+		{
+			description: "Provider set should be recognized",
+			name:        "cloudflare",
+			expected:    true,
+		},
+		{
+			description: "Qrator should not be a set, as it does not publish its networks",
+			name:        "qrator",
+			expected:    false,
+		},
+		{
+			description: "Network in CIDR notation should not be a set",
+			name:        "10.0.0.0/8",
+			expected:    false,
+		},
+		{
+			description: "Set names should be case sensitive",
+			name:        "Private",
+			expected:    false,
+		},
+		{
+			description: "Empty name should not be a set",
+			name:        "",
+			expected:    false,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			assert.Equal(framework, test.expected, IsNamedSet(test.name))
+		})
+	}
+}
+
+func TestNames(framework *testing.T) {
+	names := Names()
+
+	assert.True(framework, sort.StringsAreSorted(names))
+	assert.Len(framework, names, len(_sets))
+	for _, name := range names {
+		assert.True(framework, IsNamedSet(name), name)
+	}
+}
+
+func TestLookup(framework *testing.T) {
+	framework.Parallel()
+
+	testCases := []struct {
+		description string
+		name        string
+		contains    []string
+		excludes    []string
+	}{
+		{
+			description: "Private set should hold the RFC 1918 and unique local networks",
+			name:        "private",
+			contains:    []string{"10.1.2.3", "172.16.0.1", "192.168.1.1", "fd00::1"},
+			excludes:    []string{"8.8.8.8", "172.32.0.1", "2001:db8::1"},
+		},
+		{
+			description: "Loopback set should hold both families",
+			name:        "loopback",
+			contains:    []string{"127.0.0.1", "::1"},
+			excludes:    []string{"10.0.0.1", "::2"},
+		},
+		{
+			description: "Cloudflare set should hold the published edge networks",
+			name:        "cloudflare",
+			contains:    []string{"173.245.48.1", "104.16.0.1", "2606:4700::1"},
+			excludes:    []string{"8.8.8.8", "2001:4860::1"},
+		},
+		{
+			description: "Bogon set should hold the special-purpose networks",
+			name:        "bogon",
+			contains:    []string{"0.0.0.1", "192.0.2.1", "240.0.0.1", "2001:db8::1", "ff02::1"},
+			excludes:    []string{"8.8.8.8", "2001:4860::1"},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			prefixes, ok := Lookup(test.name)
+			require.True(framework, ok)
+
+			for _, address := range test.contains {
+				assert.True(framework, containsAddress(prefixes, address), address)
+			}
+			for _, address := range test.excludes {
+				assert.False(framework, containsAddress(prefixes, address), address)
+			}
+		})
+	}
+}
+
+func TestLookupEverySet(framework *testing.T) {
+	for _, name := range Names() {
+		prefixes, ok := Lookup(name)
+
+		assert.True(framework, ok, name)
+		assert.NotEmpty(framework, prefixes, name)
+		for _, prefix := range prefixes {
+			assert.Equal(framework, prefix.Masked(), prefix, "%s holds %s, which is not the network address", name, prefix)
+		}
+	}
+
+	_, ok := Lookup("unknown")
+	assert.False(framework, ok)
+}
+
+// containsAddress returns true if any of the prefixes contains the address.
+func containsAddress(prefixes []netip.Prefix, address string) bool {
+	ip := netip.MustParseAddr(address)
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package providers
+
+import (
+	"fmt"
+	"github.com/darki73/traefik-real-ip/pkg/cidr"
+	"github.com/darki73/traefik-real-ip/pkg/networks"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+const (
+	// AddressEmpty is the reason for empty values.
+	AddressEmpty = "empty value"
+	// AddressUnknown is the reason for the "unknown" identifier of RFC 7239.
+	AddressUnknown = "unknown identifier"
+	// AddressObfuscated is the reason for obfuscated identifiers of RFC 7239, such as "_hidden".
+	AddressObfuscated = "obfuscated identifier"
+	// AddressQuotes is the reason for values with unbalanced quotes.
+	AddressQuotes = "unbalanced quotes"
+	// AddressBrackets is the reason for values with unbalanced brackets, or brackets around IPv4 addresses.
+	AddressBrackets = "invalid brackets"
+	// AddressPort is the reason for values whose port is not a number between 0 and 65535.
+	AddressPort = "invalid port"
+	// AddressZone is the reason for IPv6 addresses with zones, which are only meaningful on the local host.
+	AddressZone = "zone not allowed"
+	// AddressSyntax is the reason for values which are not IP addresses.
+	AddressSyntax = "not an IP address"
+)
+
+// AddressError describes why a header value was refused as an IP address.
+type AddressError struct {
+	// Value is the refused value.
+	Value string
+	// Reason is one of the Address* constants.
+	Reason string
+}
+
+// Error returns the description of the error.
+func (err *AddressError) Error() string {
+	return fmt.Sprintf("address %q refused: %s", err.Value, err.Reason)
+}
+
+// ParseAddress parses the header value into an IP address and an optional port.
+// Surrounding quotes, brackets and ports are stripped, as in "[2001:db8::1]:443", and IPv4-mapped IPv6
+// addresses are unmapped so they match IPv4 networks. Zones, RFC 7239 "unknown" and obfuscated identifiers
+// are refused. The port is zero when the value does not contain one.
+func ParseAddress(value string) (netip.AddrPort, error) {
+	address := strings.TrimSpace(value)
+
+	if strings.HasPrefix(address, `"`) || strings.HasSuffix(address, `"`) {
+		if len(address) < 2 || !strings.HasPrefix(address, `"`) || !strings.HasSuffix(address, `"`) {
+			return netip.AddrPort{}, &AddressError{Value: value, Reason: AddressQuotes}
+		}
+		address = strings.TrimSpace(address[1 : len(address)-1])
+	}
+
+	if address == "" {
+		return netip.AddrPort{}, &AddressError{Value: value, Reason: AddressEmpty}
+	}
+
+	if strings.EqualFold(address, "unknown") {
+		return netip.AddrPort{}, &AddressError{Value: value, Reason: AddressUnknown}
+	}
+
+	if strings.HasPrefix(address, "_") {
+		return netip.AddrPort{}, &AddressError{Value: value, Reason: AddressObfuscated}
+	}
+
+	host, port, bracketed, reason := splitHostPort(address)
+	if reason != "" {
+		return netip.AddrPort{}, &AddressError{Value: value, Reason: reason}
+	}
+
+	if strings.Contains(host, "%") {
+		return netip.AddrPort{}, &AddressError{Value: value, Reason: AddressZone}
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.AddrPort{}, &AddressError{Value: value, Reason: AddressSyntax}
+	}
+
+	if bracketed && ip.Is4() {
+		return netip.AddrPort{}, &AddressError{Value: value, Reason: AddressBrackets}
+	}
+
+	return netip.AddrPortFrom(ip.Unmap(), port), nil
+}
+
+// splitHostPort splits the address into the host and the port.
+// IPv6 addresses have to be enclosed in brackets to carry a port, unbracketed ones are returned as is.
+func splitHostPort(address string) (string, uint16, bool, string) {
+	if strings.HasPrefix(address, "[") {
+		end := strings.IndexByte(address, ']')
+		if end < 0 {
+			return "", 0, true, AddressBrackets
+		}
+
+		host, rest := address[1:end], address[end+1:]
+		if rest == "" {
+			return host, 0, true, ""
+		}
+		if !strings.HasPrefix(rest, ":") {
+			return "", 0, true, AddressBrackets
+		}
+
+		port, ok := parsePort(rest[1:])
+		if !ok {
+			return "", 0, true, AddressPort
+		}
+
+		return host, port, true, ""
+	}
+
+	if strings.Contains(address, "]") {
+		return "", 0, false, AddressBrackets
+	}
+
+	if strings.Count(address, ":") != 1 {
+		return address, 0, false, ""
+	}
+
+	host, rawPort, _ := strings.Cut(address, ":")
+	port, ok := parsePort(rawPort)
+	if !ok {
+		return "", 0, false, AddressPort
+	}
+
+	return host, port, false, ""
+}
+
+// parsePort parses the decimal port number.
+func parsePort(value string) (uint16, bool) {
+	port, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return 0, false
+	}
+
+	return uint16(port), true
+}
+
+// SplitForwardedFor splits the X-Forwarded-For header value into the list of addresses.
+func SplitForwardedFor(value string) []string {
+	forwardChain := strings.Split(value, ",")
+	for index, ip := range forwardChain {
+		forwardChain[index] = strings.TrimSpace(ip)
+	}
+	return forwardChain
+}
+
+// newEdgeMatcher creates the matcher of the built-in edge networks of the provider.
+func newEdgeMatcher(provider string) *cidr.Matcher {
+	prefixes, _ := networks.Lookup(provider)
+
+	matcher := cidr.NewMatcher()
+	matcher.InsertAll(prefixes, provider)
+
+	return matcher
+}
@@ -0,0 +1,64 @@
+package providers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddress(framework *testing.T) {
+	testCases := []struct {
+		description    string
+		value          string
+		expectedIP     string
+		expectedPort   uint16
+		expectedReason string
+	}{
+		{description: "IPv4 address should be parsed", value: "203.0.113.7", expectedIP: "203.0.113.7"},
+		{description: "IPv4 address with port should be parsed", value: "203.0.113.7:51234", expectedIP: "203.0.113.7", expectedPort: 51234},
+		{description: "IPv6 address should be parsed", value: "2001:db8::1", expectedIP: "2001:db8::1"},
+		{description: "Bracketed IPv6 address should be parsed", value: "[2001:db8::1]", expectedIP: "2001:db8::1"},
+		{description: "Bracketed IPv6 address with port should be parsed", value: "[2001:db8::1]:443", expectedIP: "2001:db8::1", expectedPort: 443},
+		{description: "Quoted bracketed IPv6 address should be parsed", value: `"[2001:db8::1]"`, expectedIP: "2001:db8::1"},
+		{description: "Quoted bracketed IPv6 address with port should be parsed", value: `"[2001:db8::1]:8080"`, expectedIP: "2001:db8::1", expectedPort: 8080},
+		{description: "Surrounding whitespace should be ignored", value: "  203.0.113.7  ", expectedIP: "203.0.113.7"},
+		{description: "IPv4-mapped IPv6 address should be unmapped", value: "::ffff:203.0.113.7", expectedIP: "203.0.113.7"},
+		{description: "Bracketed IPv4-mapped IPv6 address with port should be unmapped", value: "[::ffff:203.0.113.7]:80", expectedIP: "203.0.113.7", expectedPort: 80},
+		{description: "Empty value should be refused", value: "", expectedReason: AddressEmpty},
+		{description: "Empty quoted value should be refused", value: `""`, expectedReason: AddressEmpty},
+		{description: "Unknown identifier should be refused", value: "unknown", expectedReason: AddressUnknown},
+		{description: "Obfuscated identifier should be refused", value: "_hidden", expectedReason: AddressObfuscated},
+		{description: "Unbalanced quotes should be refused", value: `"203.0.113.7`, expectedReason: AddressQuotes},
+		{description: "Unbalanced brackets should be refused", value: "[2001:db8::1", expectedReason: AddressBrackets},
+		{description: "Closing bracket without opening one should be refused", value: "2001:db8::1]", expectedReason: AddressBrackets},
+		{description: "Bracketed IPv4 address should be refused", value: "[203.0.113.7]", expectedReason: AddressBrackets},
+		{description: "Garbage after brackets should be refused", value: "[2001:db8::1]443", expectedReason: AddressBrackets},
+		{description: "Port out of range should be refused", value: "203.0.113.7:70000", expectedReason: AddressPort},
+		{description: "Obfuscated port should be refused", value: "[2001:db8::1]:_port", expectedReason: AddressPort},
+		{description: "Zone should be refused", value: "fe80::1%eth0", expectedReason: AddressZone},
+		{description: "Bracketed zone should be refused", value: "[fe80::1%eth0]:443", expectedReason: AddressZone},
+		{description: "Hostname should be refused", value: "example.com", expectedReason: AddressSyntax},
+		{description: "Truncated IPv4 address should be refused", value: "203.0.113", expectedReason: AddressSyntax},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			address, err := ParseAddress(test.value)
+
+			if test.expectedReason != "" {
+				var addressError *AddressError
+				require.True(framework, errors.As(err, &addressError))
+				assert.Equal(framework, test.expectedReason, addressError.Reason)
+				assert.Equal(framework, test.value, addressError.Value)
+				return
+			}
+
+			require.NoError(framework, err)
+			assert.Equal(framework, test.expectedIP, address.Addr().String())
+			assert.Equal(framework, test.expectedPort, address.Port())
+		})
+	}
+}
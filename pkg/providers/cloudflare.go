@@ -1,9 +1,9 @@
 package providers
 
 import (
-	"net"
+	"github.com/darki73/traefik-real-ip/pkg/cidr"
 	"net/http"
-	"strings"
+	"net/netip"
 )
 
 const (
@@ -13,24 +13,22 @@ const (
 
 // CloudflareProvider is the provider for Cloudflare.
 type CloudflareProvider struct {
-	name              string
-	headers           []string
-	values            map[string]string
-	excludedNetworks  []*net.IPNet
-	excludedAddresses []net.IP
+	name         string
+	headers      []string
+	options      Options
+	edgeNetworks *cidr.Matcher
 }
 
 // InitializeCloudflareProvider initializes the Cloudflare provider.
-func InitializeCloudflareProvider(excludedNetworks []*net.IPNet, excludedAddresses []net.IP) *CloudflareProvider {
+func InitializeCloudflareProvider(options Options) *CloudflareProvider {
 	return &CloudflareProvider{
 		name: "cloudflare",
 		headers: []string{
 			_cloudflareProviderTrueClientIPHeader,
 			_cloudflareProviderCFConnectingIPHeader,
 		},
-		values:            make(map[string]string),
-		excludedNetworks:  excludedNetworks,
-		excludedAddresses: excludedAddresses,
+		options:      options,
+		edgeNetworks: newEdgeMatcher("cloudflare"),
 	}
 }
 
@@ -44,62 +42,47 @@ func (cfp *CloudflareProvider) GetHeaders() []string {
 	return cfp.headers
 }
 
-// GetValues returns the header => value pairs which are specific to this provider.
-func (cfp *CloudflareProvider) GetValues() map[string]string {
-	return cfp.values
+// GetEdgeNetworks returns the networks Cloudflare edge servers connect from.
+func (cfp *CloudflareProvider) GetEdgeNetworks() *cidr.Matcher {
+	return cfp.edgeNetworks
 }
 
-// GetRealIP returns the real IP address of the client.
-func (cfp *CloudflareProvider) GetRealIP(request *http.Request) string {
-	cfp.fillValues(request)
-
-	for _, value := range cfp.GetValues() {
-		if !cfp.isExcludedIP(value) {
-			return value
-		}
-	}
+// CollectValues returns the header => value pairs which are specific to this provider.
+func (cfp *CloudflareProvider) CollectValues(request *http.Request) map[string]string {
+	result := newResult(cfp.GetName())
+	cfp.fillValues(request, result)
+	return result.Values
+}
 
-	return ""
+// GetRealIP returns the real IP address of the client.
+func (cfp *CloudflareProvider) GetRealIP(request *http.Request) netip.Addr {
+	return cfp.Resolve(request).IP
 }
 
-// fillValues fills the values map with the headers from the request.
-func (cfp *CloudflareProvider) fillValues(request *http.Request) {
+// Resolve returns the result of the real IP resolution.
+func (cfp *CloudflareProvider) Resolve(request *http.Request) *Result {
+	result := newResult(cfp.GetName())
+	cfp.fillValues(request, result)
+
 	for _, header := range cfp.GetHeaders() {
-		if value := request.Header.Get(header); value != "" {
-			cfp.values[header] = strings.TrimSpace(value)
+		value, ok := result.Values[header]
+		if !ok {
+			continue
+		}
+		if candidate, ok := cfp.options.evaluate(result, header, value); ok {
+			result.resolve(header, candidate)
+			break
 		}
 	}
-}
 
-// getExcludedNetworks returns the list of excluded networks.
-func (cfp *CloudflareProvider) getExcludedNetworks() []*net.IPNet {
-	return cfp.excludedNetworks
+	return result
 }
 
-// getExcludedAddresses returns the list of excluded addresses.
-func (cfp *CloudflareProvider) getExcludedAddresses() []net.IP {
-	return cfp.excludedAddresses
-}
-
-// isExcludedIP returns true if the IP is excluded.
-func (cfp *CloudflareProvider) isExcludedIP(address string) bool {
-	ip := net.ParseIP(address)
-
-	if ip == nil {
-		return true
-	}
-
-	for _, excludedNetwork := range cfp.getExcludedNetworks() {
-		if excludedNetwork.Contains(ip) {
-			return true
-		}
-	}
-
-	for _, excludedAddress := range cfp.getExcludedAddresses() {
-		if ip.Equal(excludedAddress) {
-			return true
+// fillValues fills the values map of the result with the headers from the request.
+func (cfp *CloudflareProvider) fillValues(request *http.Request, result *Result) {
+	for _, header := range cfp.GetHeaders() {
+		if value, ok := cfp.options.readHeader(result, request, header); ok {
+			result.Values[header] = value
 		}
 	}
-
-	return false
 }
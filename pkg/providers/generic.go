@@ -1,8 +1,8 @@
 package providers
 
 import (
-	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 )
 
@@ -13,24 +13,20 @@ const (
 
 // GenericProvider is the generic provider.
 type GenericProvider struct {
-	name              string
-	headers           []string
-	values            map[string]string
-	excludedNetworks  []*net.IPNet
-	excludedAddresses []net.IP
+	name    string
+	headers []string
+	options Options
 }
 
 // InitializeGenericProvider initializes the Generic provider.
-func InitializeGenericProvider(excludedNetworks []*net.IPNet, excludedAddresses []net.IP) *GenericProvider {
+func InitializeGenericProvider(options Options) *GenericProvider {
 	return &GenericProvider{
 		name: "generic",
 		headers: []string{
 			_genericProviderXForwardedForHeader,
 			_genericProviderXRealIPHeader,
 		},
-		values:            map[string]string{},
-		excludedNetworks:  excludedNetworks,
-		excludedAddresses: excludedAddresses,
+		options: options,
 	}
 }
 
@@ -44,74 +40,64 @@ func (gp *GenericProvider) GetHeaders() []string {
 	return gp.headers
 }
 
-// GetValues returns the header => value pairs which are specific to this provider.
-func (gp *GenericProvider) GetValues() map[string]string {
-	return gp.values
+// CollectValues returns the header => value pairs which are specific to this provider.
+func (gp *GenericProvider) CollectValues(request *http.Request) map[string]string {
+	result := newResult(gp.GetName())
+	gp.fillValues(request, result)
+	return result.Values
 }
 
-// GetRealIP returns the real IP address of the client.
-func (gp *GenericProvider) GetRealIP(request *http.Request) string {
-	gp.fillValues(request)
-
-	if value, ok := gp.GetValues()[_genericProviderXRealIPHeader]; ok {
-		if !gp.isExcludedIP(value) {
-			return value
-		}
-	}
+// GetForwardedForIP returns the first address of the X-Forwarded-For chain which is not excluded.
+func (gp *GenericProvider) GetForwardedForIP(value string) netip.Addr {
+	for chain, more := value, true; more; {
+		var address string
+		address, chain, more = strings.Cut(chain, ",")
 
-	if value, ok := gp.GetValues()[_genericProviderXForwardedForHeader]; ok {
-		forwardChain := strings.Split(value, ",")
-		for index, ip := range forwardChain {
-			forwardChain[index] = strings.TrimSpace(ip)
-		}
-		for _, ip := range forwardChain {
-			if !gp.isExcludedIP(ip) {
-				return ip
-			}
+		if candidate, ok := gp.options.evaluate(nil, _genericProviderXForwardedForHeader, address); ok {
+			return candidate.Addr()
 		}
 	}
 
-	return ""
-}
-
-// fillValues fills the values map with the headers from the request.
-func (gp *GenericProvider) fillValues(request *http.Request) {
-	for _, header := range gp.GetHeaders() {
-		if value := request.Header.Get(header); value != "" {
-			gp.values[header] = strings.TrimSpace(value)
-		}
-	}
+	return netip.Addr{}
 }
 
-// getExcludedNetworks returns the list of excluded networks.
-func (gp *GenericProvider) getExcludedNetworks() []*net.IPNet {
-	return gp.excludedNetworks
-}
-
-// getExcludedAddresses returns the list of excluded addresses.
-func (gp *GenericProvider) getExcludedAddresses() []net.IP {
-	return gp.excludedAddresses
+// GetRealIP returns the real IP address of the client.
+func (gp *GenericProvider) GetRealIP(request *http.Request) netip.Addr {
+	return gp.Resolve(request).IP
 }
 
-// isExcludedIP returns true if the IP is excluded.
-func (gp *GenericProvider) isExcludedIP(address string) bool {
-	ip := net.ParseIP(address)
+// Resolve returns the result of the real IP resolution.
+func (gp *GenericProvider) Resolve(request *http.Request) *Result {
+	result := newResult(gp.GetName())
+	gp.fillValues(request, result)
 
-	if ip == nil {
-		return true
+	if value, ok := result.Values[_genericProviderXRealIPHeader]; ok {
+		if candidate, ok := gp.options.evaluate(result, _genericProviderXRealIPHeader, value); ok {
+			result.resolve(_genericProviderXRealIPHeader, candidate)
+			return result
+		}
 	}
 
-	for _, excludedNetwork := range gp.getExcludedNetworks() {
-		if excludedNetwork.Contains(ip) {
-			return true
+	if value, ok := result.Values[_genericProviderXForwardedForHeader]; ok {
+		for chain, more := value, true; more; {
+			var address string
+			address, chain, more = strings.Cut(chain, ",")
+
+			if candidate, ok := gp.options.evaluate(result, _genericProviderXForwardedForHeader, strings.TrimSpace(address)); ok {
+				result.resolve(_genericProviderXForwardedForHeader, candidate)
+				return result
+			}
 		}
 	}
 
-	for _, excludedAddress := range gp.getExcludedAddresses() {
-		if ip.Equal(excludedAddress) {
-			return true
+	return result
+}
+
+// fillValues fills the values map of the result with the headers from the request.
+func (gp *GenericProvider) fillValues(request *http.Request, result *Result) {
+	for _, header := range gp.GetHeaders() {
+		if value, ok := gp.options.readHeader(result, request, header); ok {
+			result.Values[header] = value
 		}
 	}
-
-	return false
 }
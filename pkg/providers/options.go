@@ -0,0 +1,234 @@
+package providers
+
+import (
+	"github.com/darki73/traefik-real-ip/pkg/cidr"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	// RejectionMalformed is the reason for values which are not IP addresses.
+	RejectionMalformed = "malformed"
+	// RejectionExcluded is the reason for addresses from excluded networks or excluded addresses.
+	RejectionExcluded = "excluded"
+	// RejectionBogon is the reason for addresses which can never belong to a client.
+	RejectionBogon = "bogon"
+
+	// LimitActionTruncate inspects the header only up to the limit.
+	LimitActionTruncate = "truncate"
+	// LimitActionIgnore ignores the header as if it was not sent.
+	LimitActionIgnore = "ignore"
+	// LimitActionReject ignores the header and marks the request for rejection.
+	LimitActionReject = "reject"
+
+	// LimitHeaderBytes is the limit of the header value length in bytes.
+	LimitHeaderBytes = "header bytes"
+	// LimitChainLength is the limit of the number of addresses in list headers such as X-Forwarded-For.
+	LimitChainLength = "chain length"
+	// LimitHeaderLines is the limit of the number of lines of the same header.
+	LimitHeaderLines = "header lines"
+
+	// DuplicateActionFirst uses the first line of a duplicated single value header.
+	DuplicateActionFirst = "first"
+	// DuplicateActionLast uses the last line of a duplicated single value header.
+	DuplicateActionLast = "last"
+	// DuplicateActionIgnore ignores a duplicated single value header as if it was not sent.
+	DuplicateActionIgnore = "ignore"
+	// DuplicateActionReject ignores a duplicated single value header and marks the request for rejection.
+	DuplicateActionReject = "reject"
+)
+
+// _headerKeys maps the provider headers to their canonical form, so looking them up does not allocate.
+var _headerKeys = canonicalKeys(
+	_genericProviderXForwardedForHeader,
+	_genericProviderXRealIPHeader,
+	_cloudflareProviderTrueClientIPHeader,
+	_cloudflareProviderCFConnectingIPHeader,
+	_qratorProviderXQratorIPSourceHeader,
+)
+
+// Options holds the configuration shared by the providers.
+type Options struct {
+	// Exclusions holds the networks and addresses which are never the real IP address.
+	Exclusions *cidr.Matcher
+	// Bogons holds the networks whose addresses are not valid client addresses.
+	Bogons *cidr.Matcher
+	// Limits holds the limits of the inspected headers.
+	Limits Limits
+	// Duplicates is one of the DuplicateAction* constants, taken when a single value header is sent more than once.
+	Duplicates string
+}
+
+// Limits holds the limits protecting the providers from abusive headers, zero disables a limit.
+type Limits struct {
+	// MaxHeaderBytes is the maximum length of a header value in bytes.
+	MaxHeaderBytes int
+	// MaxChainLength is the maximum number of addresses inspected in list headers.
+	MaxChainLength int
+	// MaxHeaderLines is the maximum number of lines of the same header.
+	MaxHeaderLines int
+	// Action is one of the LimitAction* constants, taken when a limit is exceeded.
+	Action string
+}
+
+// DefaultLimits returns the limits applied by the Traefik plugin unless configured otherwise.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxHeaderBytes: 8192,
+		MaxChainLength: 64,
+		MaxHeaderLines: 16,
+		Action:         LimitActionTruncate,
+	}
+}
+
+// evaluate checks the header value and returns the address if it is a valid candidate for the real IP address.
+// Rejected values are recorded on the result, if one is given.
+func (options Options) evaluate(result *Result, header string, value string) (netip.AddrPort, bool) {
+	address, err := ParseAddress(value)
+	if err != nil {
+		result.reject(header, value, RejectionMalformed, cidr.Entry{}, err)
+		return netip.AddrPort{}, false
+	}
+
+	if entry, ok := options.Exclusions.Lookup(address.Addr()); ok {
+		result.reject(header, value, RejectionExcluded, entry, nil)
+		return netip.AddrPort{}, false
+	}
+
+	if entry, ok := options.Bogons.Lookup(address.Addr()); ok {
+		result.reject(header, value, RejectionBogon, entry, nil)
+		return netip.AddrPort{}, false
+	}
+
+	return address, true
+}
+
+// readHeader returns the value of the header, applying the limits.
+// Lines of list headers are merged in order, as if they were sent as a single comma separated line,
+// while duplicated single value headers are handled according to the configured action.
+// It returns false if the header was not sent, or was ignored because it exceeded a limit or was duplicated.
+func (options Options) readHeader(result *Result, request *http.Request, header string) (string, bool) {
+	lines := request.Header[headerKey(header)]
+	if len(lines) == 0 {
+		return "", false
+	}
+
+	limits := options.Limits
+
+	if limits.MaxHeaderLines > 0 && len(lines) > limits.MaxHeaderLines {
+		if !options.exceed(result, header, LimitHeaderLines) {
+			return "", false
+		}
+		lines = lines[:limits.MaxHeaderLines]
+	}
+
+	value, ok := options.mergeLines(result, header, lines)
+	if !ok {
+		return "", false
+	}
+
+	if limits.MaxHeaderBytes > 0 && len(value) > limits.MaxHeaderBytes {
+		if !options.exceed(result, header, LimitHeaderBytes) || !isListHeader(header) {
+			return "", false
+		}
+		value = truncateBytes(value, limits.MaxHeaderBytes)
+	}
+
+	if limits.MaxChainLength > 0 && isListHeader(header) && strings.Count(value, ",") >= limits.MaxChainLength {
+		if !options.exceed(result, header, LimitChainLength) {
+			return "", false
+		}
+		value = truncateChain(value, limits.MaxChainLength)
+	}
+
+	if value == "" {
+		return "", false
+	}
+
+	return value, true
+}
+
+// mergeLines returns the single value of the header lines.
+// It returns false if the header is a duplicated single value header which should be ignored.
+func (options Options) mergeLines(result *Result, header string, lines []string) (string, bool) {
+	if len(lines) == 1 {
+		return strings.TrimSpace(lines[0]), true
+	}
+
+	if isListHeader(header) {
+		merged := make([]string, 0, len(lines))
+		for _, line := range lines {
+			if line = strings.TrimSpace(line); line != "" {
+				merged = append(merged, line)
+			}
+		}
+		return strings.Join(merged, ", "), true
+	}
+
+	result.duplicate(header)
+
+	switch options.Duplicates {
+	case DuplicateActionLast:
+		return strings.TrimSpace(lines[len(lines)-1]), true
+	case DuplicateActionIgnore, DuplicateActionReject:
+		return "", false
+	default:
+		return strings.TrimSpace(lines[0]), true
+	}
+}
+
+// exceed records the exceeded limit and returns true if the header should be truncated rather than ignored.
+func (options Options) exceed(result *Result, header string, limit string) bool {
+	result.exceed(header, limit)
+
+	return options.Limits.Action == LimitActionTruncate
+}
+
+// headerKey returns the canonical form of the header.
+func headerKey(header string) string {
+	if key, ok := _headerKeys[header]; ok {
+		return key
+	}
+
+	return http.CanonicalHeaderKey(header)
+}
+
+// canonicalKeys returns the header => canonical header pairs of the headers.
+func canonicalKeys(headers ...string) map[string]string {
+	keys := make(map[string]string, len(headers))
+	for _, header := range headers {
+		keys[header] = http.CanonicalHeaderKey(header)
+	}
+
+	return keys
+}
+
+// isListHeader returns true if the header holds a comma separated list of addresses.
+func isListHeader(header string) bool {
+	return header == _genericProviderXForwardedForHeader
+}
+
+// truncateBytes returns the complete list elements which fit into the given number of bytes.
+func truncateBytes(value string, maxBytes int) string {
+	end := strings.LastIndexByte(value[:maxBytes+1], ',')
+	if end < 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(value[:end])
+}
+
+// truncateChain returns the first elements of the list.
+func truncateChain(value string, maxLength int) string {
+	end := 0
+	for index := 0; index < maxLength; index++ {
+		next := strings.IndexByte(value[end:], ',')
+		if next < 0 {
+			return value
+		}
+		end += next + 1
+	}
+
+	return strings.TrimSpace(value[:end-1])
+}
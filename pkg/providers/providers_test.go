@@ -0,0 +1,194 @@
+package providers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/darki73/traefik-real-ip/pkg/cidr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenericProviderMappedAddresses(framework *testing.T) {
+	exclusions := cidr.NewMatcher()
+	exclusions.Insert(netip.MustParsePrefix("10.0.0.0/8"), "excludedNetworks")
+	exclusions.InsertAddr(netip.MustParseAddr("192.168.1.1"), "excludedAddresses")
+	provider := InitializeGenericProvider(Options{Exclusions: exclusions})
+
+	testCases := []struct {
+		description  string
+		forwardedFor string
+		expectedIP   string
+	}{
+		{
+			description:  "IPv4-mapped IPv6 addresses should be unmapped",
+			forwardedFor: "::ffff:8.8.8.8",
+			expectedIP:   "8.8.8.8",
+		},
+		{
+			description:  "IPv4-mapped IPv6 addresses should match excluded IPv4 networks",
+			forwardedFor: "::ffff:10.0.0.1, 8.8.8.8",
+			expectedIP:   "8.8.8.8",
+		},
+		{
+			description:  "IPv4-mapped IPv6 addresses should match excluded IPv4 addresses",
+			forwardedFor: "::ffff:192.168.1.1, 8.8.8.8",
+			expectedIP:   "8.8.8.8",
+		},
+		{
+			description:  "Addresses with zones should be rejected",
+			forwardedFor: "fe80::1%eth0, 8.8.8.8",
+			expectedIP:   "8.8.8.8",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+			request.Header.Set("X-Forwarded-For", test.forwardedFor)
+
+			assert.Equal(framework, test.expectedIP, provider.GetRealIP(request).String())
+		})
+	}
+}
+
+func BenchmarkGenericProviderResolve(benchmark *testing.B) {
+	exclusions := cidr.NewMatcher()
+	exclusions.InsertAll([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("172.16.0.0/12"),
+		netip.MustParsePrefix("192.168.0.0/16"),
+	}, "excludedNetworks")
+	exclusions.InsertAddr(netip.MustParseAddr("127.0.0.1"), "excludedAddresses")
+	provider := InitializeGenericProvider(Options{Exclusions: exclusions})
+
+	request := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	request.Header.Set("X-Forwarded-For", "10.0.0.1, 172.16.0.1, 192.168.0.1, 127.0.0.1, 8.8.8.8")
+
+	benchmark.ReportAllocs()
+	benchmark.ResetTimer()
+
+	for index := 0; index < benchmark.N; index++ {
+		provider.Resolve(request)
+	}
+}
+
+func TestProviderAllocationBudget(framework *testing.T) {
+	if testing.Short() {
+		framework.Skip("allocation budget is not checked in short mode")
+	}
+
+	// Every resolution allocates the result, its values map and the consulted header lines.
+	testCases := []struct {
+		description string
+		provider    interface{ Resolve(*http.Request) *Result }
+		headers     map[string]string
+		budget      float64
+	}{
+		{
+			description: "generic",
+			provider:    InitializeGenericProvider(Options{}),
+			headers:     map[string]string{"X-Forwarded-For": "8.8.8.8, 10.0.0.1"},
+			budget:      3,
+		},
+		{
+			description: "cloudflare",
+			provider:    InitializeCloudflareProvider(Options{}),
+			headers:     map[string]string{"CF-Connecting-IP": "8.8.8.8"},
+			budget:      3,
+		},
+		{
+			description: "qrator",
+			provider:    InitializeQratorProvider(Options{}),
+			headers:     map[string]string{"X-Qrator-IP-Source": "8.8.8.8"},
+			budget:      3,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+			for key, value := range test.headers {
+				request.Header.Set(key, value)
+			}
+
+			allocations := testing.AllocsPerRun(100, func() {
+				test.provider.Resolve(request)
+			})
+
+			if allocations > test.budget {
+				framework.Errorf("Resolve made %.0f allocations, the budget is %.0f", allocations, test.budget)
+			}
+		})
+	}
+}
+
+func BenchmarkGenericProviderResolveLongChain(benchmark *testing.B) {
+	exclusions := cidr.NewMatcher()
+	exclusions.Insert(netip.MustParsePrefix("10.0.0.0/8"), "excludedNetworks")
+	provider := InitializeGenericProvider(Options{Exclusions: exclusions})
+
+	chain := make([]string, 0, 64)
+	for index := 0; index < 63; index++ {
+		chain = append(chain, netip.AddrFrom4([4]byte{10, 0, byte(index / 256), byte(index % 256)}).String())
+	}
+	chain = append(chain, "8.8.8.8")
+
+	request := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	request.Header.Set("X-Forwarded-For", strings.Join(chain, ", "))
+
+	benchmark.ReportAllocs()
+	benchmark.ResetTimer()
+
+	for index := 0; index < benchmark.N; index++ {
+		provider.Resolve(request)
+	}
+}
+
+func BenchmarkGenericProviderResolveIPv6(benchmark *testing.B) {
+	exclusions := cidr.NewMatcher()
+	exclusions.Insert(netip.MustParsePrefix("fc00::/7"), "excludedNetworks")
+	provider := InitializeGenericProvider(Options{Exclusions: exclusions})
+
+	request := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	request.Header.Set("X-Forwarded-For", "fd00::1, [2001:4860:4860::8888]:443")
+
+	benchmark.ReportAllocs()
+	benchmark.ResetTimer()
+
+	for index := 0; index < benchmark.N; index++ {
+		provider.Resolve(request)
+	}
+}
+
+func BenchmarkCloudflareProviderResolve(benchmark *testing.B) {
+	provider := InitializeCloudflareProvider(Options{})
+
+	request := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	request.Header.Set("CF-Connecting-IP", "8.8.8.8")
+
+	benchmark.ReportAllocs()
+	benchmark.ResetTimer()
+
+	for index := 0; index < benchmark.N; index++ {
+		provider.Resolve(request)
+	}
+}
+
+func BenchmarkQratorProviderResolve(benchmark *testing.B) {
+	provider := InitializeQratorProvider(Options{})
+
+	request := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	request.Header.Set("X-Qrator-IP-Source", "8.8.8.8")
+
+	benchmark.ReportAllocs()
+	benchmark.ResetTimer()
+
+	for index := 0; index < benchmark.N; index++ {
+		provider.Resolve(request)
+	}
+}
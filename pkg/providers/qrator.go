@@ -1,9 +1,9 @@
 package providers
 
 import (
-	"net"
+	"github.com/darki73/traefik-real-ip/pkg/cidr"
 	"net/http"
-	"strings"
+	"net/netip"
 )
 
 const (
@@ -12,23 +12,21 @@ const (
 
 // QratorProvider is the provider for Qrator.
 type QratorProvider struct {
-	name              string
-	headers           []string
-	values            map[string]string
-	excludedNetworks  []*net.IPNet
-	excludedAddresses []net.IP
+	name         string
+	headers      []string
+	options      Options
+	edgeNetworks *cidr.Matcher
 }
 
 // InitializeQratorProvider initializes the provider.
-func InitializeQratorProvider(excludedNetworks []*net.IPNet, excludedAddresses []net.IP) *QratorProvider {
+func InitializeQratorProvider(options Options) *QratorProvider {
 	return &QratorProvider{
 		name: "qrator",
 		headers: []string{
 			_qratorProviderXQratorIPSourceHeader,
 		},
-		values:            map[string]string{},
-		excludedNetworks:  excludedNetworks,
-		excludedAddresses: excludedAddresses,
+		options:      options,
+		edgeNetworks: cidr.NewMatcher(),
 	}
 }
 
@@ -42,62 +40,48 @@ func (qp *QratorProvider) GetHeaders() []string {
 	return qp.headers
 }
 
-// GetValues returns the header => value pairs which are specific to this provider.
-func (qp *QratorProvider) GetValues() map[string]string {
-	return qp.values
+// GetEdgeNetworks returns the networks Qrator servers connect from.
+// Qrator does not publish them, so the matcher is always empty and the edge servers have to be listed in the trusted networks.
+func (qp *QratorProvider) GetEdgeNetworks() *cidr.Matcher {
+	return qp.edgeNetworks
 }
 
-// GetRealIP returns the real IP address of the client.
-func (qp *QratorProvider) GetRealIP(request *http.Request) string {
-	qp.fillValues(request)
-
-	for _, value := range qp.GetValues() {
-		if !qp.isExcludedIP(value) {
-			return value
-		}
-	}
+// CollectValues returns the header => value pairs which are specific to this provider.
+func (qp *QratorProvider) CollectValues(request *http.Request) map[string]string {
+	result := newResult(qp.GetName())
+	qp.fillValues(request, result)
+	return result.Values
+}
 
-	return ""
+// GetRealIP returns the real IP address of the client.
+func (qp *QratorProvider) GetRealIP(request *http.Request) netip.Addr {
+	return qp.Resolve(request).IP
 }
 
-// fillValues fills the values map with the headers from the request.
-func (qp *QratorProvider) fillValues(request *http.Request) {
+// Resolve returns the result of the real IP resolution.
+func (qp *QratorProvider) Resolve(request *http.Request) *Result {
+	result := newResult(qp.GetName())
+	qp.fillValues(request, result)
+
 	for _, header := range qp.GetHeaders() {
-		if value := request.Header.Get(header); value != "" {
-			qp.values[header] = strings.TrimSpace(value)
+		value, ok := result.Values[header]
+		if !ok {
+			continue
+		}
+		if candidate, ok := qp.options.evaluate(result, header, value); ok {
+			result.resolve(header, candidate)
+			break
 		}
 	}
-}
 
-// getExcludedNetworks returns the list of excluded networks.
-func (qp *QratorProvider) getExcludedNetworks() []*net.IPNet {
-	return qp.excludedNetworks
+	return result
 }
 
-// getExcludedAddresses returns the list of excluded addresses.
-func (qp *QratorProvider) getExcludedAddresses() []net.IP {
-	return qp.excludedAddresses
-}
-
-// isExcludedIP returns true if the IP is excluded.
-func (qp *QratorProvider) isExcludedIP(address string) bool {
-	ip := net.ParseIP(address)
-
-	if ip == nil {
-		return true
-	}
-
-	for _, excludedNetwork := range qp.getExcludedNetworks() {
-		if excludedNetwork.Contains(ip) {
-			return true
-		}
-	}
-
-	for _, excludedAddress := range qp.getExcludedAddresses() {
-		if ip.Equal(excludedAddress) {
-			return true
+// fillValues fills the values map of the result with the headers from the request.
+func (qp *QratorProvider) fillValues(request *http.Request, result *Result) {
+	for _, header := range qp.GetHeaders() {
+		if value, ok := qp.options.readHeader(result, request, header); ok {
+			result.Values[header] = value
 		}
 	}
-
-	return false
 }
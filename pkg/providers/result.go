@@ -0,0 +1,137 @@
+package providers
+
+import (
+	"github.com/darki73/traefik-real-ip/pkg/cidr"
+	"net/netip"
+)
+
+// Result describes how a provider resolved the real IP address of the client.
+type Result struct {
+	// Provider is the name of the provider which produced the result.
+	Provider string
+	// Header is the name of the header the real IP address was taken from.
+	Header string
+	// IP is the real IP address of the client, invalid if it could not be determined.
+	IP netip.Addr
+	// Port is the port of the client, zero if the header did not contain one.
+	Port uint16
+	// Values holds the header => value pairs the provider inspected.
+	Values map[string]string
+	// Malformed holds the names of the headers which contained values that are not IP addresses.
+	Malformed []string
+	// Rejected holds the values which were not accepted as the real IP address, in the order they were inspected.
+	Rejected []Rejection
+	// Exceeded holds the limits the provider headers exceeded.
+	Exceeded []Violation
+	// Duplicated holds the names of the single value headers which were sent more than once.
+	Duplicated []string
+}
+
+// Violation describes a limit exceeded by a header.
+type Violation struct {
+	// Header is the name of the header which exceeded the limit.
+	Header string
+	// Limit is one of the Limit* constants.
+	Limit string
+}
+
+// Rejection describes a header value which was not accepted as the real IP address.
+type Rejection struct {
+	// Header is the name of the header the value was taken from.
+	Header string
+	// Value is the rejected value.
+	Value string
+	// Reason is one of the Rejection* constants.
+	Reason string
+	// Match is the network which matched the value, set for excluded and bogon values.
+	Match cidr.Entry
+	// Err is the *AddressError explaining why the value was refused, set for malformed values.
+	Err error
+}
+
+// newResult creates an empty result for the given provider.
+func newResult(provider string) *Result {
+	return &Result{
+		Provider: provider,
+		Values:   make(map[string]string),
+	}
+}
+
+// IsResolved returns true if the provider determined the real IP address.
+func (result *Result) IsResolved() bool {
+	return result.IP.IsValid()
+}
+
+// HasValues returns true if the request contained any of the provider headers.
+func (result *Result) HasValues() bool {
+	return len(result.Values) > 0
+}
+
+// IsMalformed returns true if any of the provider headers contained a value which is not an IP address.
+func (result *Result) IsMalformed() bool {
+	return len(result.Malformed) > 0
+}
+
+// HasExceeded returns true if any of the provider headers exceeded a limit.
+func (result *Result) HasExceeded() bool {
+	return len(result.Exceeded) > 0
+}
+
+// HasDuplicates returns true if any of the single value provider headers was sent more than once.
+func (result *Result) HasDuplicates() bool {
+	return len(result.Duplicated) > 0
+}
+
+// resolve records the header and address as the real IP address of the client.
+func (result *Result) resolve(header string, address netip.AddrPort) {
+	result.Header = header
+	result.IP = address.Addr()
+	result.Port = address.Port()
+}
+
+// reject records the rejected header value, it is a no-op on a nil result.
+func (result *Result) reject(header string, value string, reason string, match cidr.Entry, err error) {
+	if result == nil {
+		return
+	}
+
+	if reason == RejectionMalformed && !result.hasMalformed(header) {
+		result.Malformed = append(result.Malformed, header)
+	}
+
+	result.Rejected = append(result.Rejected, Rejection{
+		Header: header,
+		Value:  value,
+		Reason: reason,
+		Match:  match,
+		Err:    err,
+	})
+}
+
+// hasMalformed returns true if the header was already recorded as malformed.
+func (result *Result) hasMalformed(header string) bool {
+	for _, malformed := range result.Malformed {
+		if malformed == header {
+			return true
+		}
+	}
+	return false
+}
+
+// exceed records the limit exceeded by the header, it is a no-op on a nil result.
+func (result *Result) exceed(header string, limit string) {
+	if result == nil {
+		return
+	}
+
+	result.Exceeded = append(result.Exceeded, Violation{Header: header, Limit: limit})
+}
+
+// duplicate records the single value header which was sent more than once, it is a no-op on a nil result.
+func (result *Result) duplicate(header string) {
+	if result == nil {
+		return
+	}
+
+	result.Duplicated = append(result.Duplicated, header)
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"github.com/darki73/traefik-real-ip/pkg/lru"
+	"math"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Options holds the configuration of the rate limiter.
+type Options struct {
+	// Rate is the number of requests per second allowed for a single client.
+	Rate float64
+	// Burst is the maximum number of requests a single client is allowed to make at once.
+	Burst int
+	// IPv4Prefix is the prefix length IPv4 addresses are aggregated to.
+	IPv4Prefix int
+	// IPv6Prefix is the prefix length IPv6 addresses are aggregated to.
+	IPv6Prefix int
+	// MaxEntries is the maximum number of clients tracked at once.
+	MaxEntries int
+}
+
+// Limiter is an in-memory token bucket rate limiter keyed by client IP address.
+type Limiter struct {
+	rate       float64
+	burst      float64
+	ipv4Prefix int
+	ipv6Prefix int
+	buckets    *lru.Cache
+	now        func() time.Time
+	mutex      sync.Mutex
+}
+
+// bucket holds the tokens available to a single client.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// New creates a rate limiter with the given options.
+func New(options Options) *Limiter {
+	burst := options.Burst
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{
+		rate:       options.Rate,
+		burst:      float64(burst),
+		ipv4Prefix: options.IPv4Prefix,
+		ipv6Prefix: options.IPv6Prefix,
+		buckets:    lru.New(options.MaxEntries),
+		now:        time.Now,
+	}
+}
+
+// Allow consumes a token for the client and returns true if the request is allowed.
+// When the request is not allowed, the time after which the client may retry is returned.
+func (limiter *Limiter) Allow(ip netip.Addr) (bool, time.Duration) {
+	key := limiter.Key(ip)
+	now := limiter.now()
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	var current *bucket
+	if value, ok := limiter.buckets.Get(key); ok {
+		current = value.(*bucket)
+		elapsed := now.Sub(current.updated).Seconds()
+		current.tokens = math.Min(limiter.burst, current.tokens+elapsed*limiter.rate)
+		current.updated = now
+	} else {
+		current = &bucket{tokens: limiter.burst, updated: now}
+		limiter.buckets.Add(key, current)
+	}
+
+	if current.tokens >= 1 {
+		current.tokens--
+		return true, 0
+	}
+
+	wait := (1 - current.tokens) / limiter.rate
+
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// Key returns the key the client is tracked under, with the address aggregated to the configured prefix.
+func (limiter *Limiter) Key(ip netip.Addr) string {
+	bits := limiter.ipv6Prefix
+	if ip.Is4() {
+		bits = limiter.ipv4Prefix
+	}
+
+	prefix, err := ip.Prefix(bits)
+	if err != nil {
+		return ip.String()
+	}
+
+	return prefix.Addr().String()
+}
+
+// Len returns the number of clients currently tracked.
+func (limiter *Limiter) Len() int {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	return limiter.buckets.Len()
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(framework *testing.T) {
+	framework.Run("Requests within the burst should be allowed", func(framework *testing.T) {
+		limiter, _ := newTestLimiter(Options{Rate: 1, Burst: 2, IPv4Prefix: 32, IPv6Prefix: 64, MaxEntries: 10})
+
+		allowed, _ := limiter.Allow(netip.MustParseAddr("10.0.0.1"))
+		assert.True(framework, allowed)
+		allowed, _ = limiter.Allow(netip.MustParseAddr("10.0.0.1"))
+		assert.True(framework, allowed)
+		allowed, retryAfter := limiter.Allow(netip.MustParseAddr("10.0.0.1"))
+		assert.False(framework, allowed)
+		assert.Equal(framework, time.Second, retryAfter)
+	})
+
+	framework.Run("Tokens should be refilled over time", func(framework *testing.T) {
+		limiter, clock := newTestLimiter(Options{Rate: 2, Burst: 1, IPv4Prefix: 32, IPv6Prefix: 64, MaxEntries: 10})
+
+		allowed, _ := limiter.Allow(netip.MustParseAddr("10.0.0.1"))
+		assert.True(framework, allowed)
+		allowed, retryAfter := limiter.Allow(netip.MustParseAddr("10.0.0.1"))
+		assert.False(framework, allowed)
+		assert.Equal(framework, 500*time.Millisecond, retryAfter)
+
+		*clock = clock.Add(500 * time.Millisecond)
+		allowed, _ = limiter.Allow(netip.MustParseAddr("10.0.0.1"))
+		assert.True(framework, allowed)
+	})
+
+	framework.Run("Clients should be tracked separately", func(framework *testing.T) {
+		limiter, _ := newTestLimiter(Options{Rate: 1, Burst: 1, IPv4Prefix: 32, IPv6Prefix: 64, MaxEntries: 10})
+
+		allowed, _ := limiter.Allow(netip.MustParseAddr("10.0.0.1"))
+		assert.True(framework, allowed)
+		allowed, _ = limiter.Allow(netip.MustParseAddr("10.0.0.2"))
+		assert.True(framework, allowed)
+	})
+
+	framework.Run("IPv6 clients should be aggregated to the configured prefix", func(framework *testing.T) {
+		limiter, _ := newTestLimiter(Options{Rate: 1, Burst: 1, IPv4Prefix: 32, IPv6Prefix: 64, MaxEntries: 10})
+
+		assert.Equal(framework, "2001:db8::", limiter.Key(netip.MustParseAddr("2001:db8::1")))
+		allowed, _ := limiter.Allow(netip.MustParseAddr("2001:db8::1"))
+		assert.True(framework, allowed)
+		allowed, _ = limiter.Allow(netip.MustParseAddr("2001:db8::ffff"))
+		assert.False(framework, allowed)
+		allowed, _ = limiter.Allow(netip.MustParseAddr("2001:db8:0:1::1"))
+		assert.True(framework, allowed)
+	})
+
+	framework.Run("Least recently used clients should be evicted", func(framework *testing.T) {
+		limiter, _ := newTestLimiter(Options{Rate: 1, Burst: 1, IPv4Prefix: 32, IPv6Prefix: 64, MaxEntries: 2})
+
+		limiter.Allow(netip.MustParseAddr("10.0.0.1"))
+		limiter.Allow(netip.MustParseAddr("10.0.0.2"))
+		limiter.Allow(netip.MustParseAddr("10.0.0.3"))
+		assert.Equal(framework, 2, limiter.Len())
+
+		allowed, _ := limiter.Allow(netip.MustParseAddr("10.0.0.1"))
+		assert.True(framework, allowed)
+	})
+}
+
+// newTestLimiter creates a limiter whose clock is controlled by the test.
+func newTestLimiter(options Options) (*Limiter, *time.Time) {
+	clock := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := New(options)
+	limiter.now = func() time.Time {
+		return clock
+	}
+	return limiter, &clock
+}
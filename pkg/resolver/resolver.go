@@ -0,0 +1,316 @@
+// Package resolver determines the real IP address of the client of an HTTP request from its forwarding headers.
+// It holds the logic of the Traefik plugin without depending on Traefik, so it can be used by any net/http server.
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/darki73/traefik-real-ip/pkg/cidr"
+	"github.com/darki73/traefik-real-ip/pkg/networks"
+	"github.com/darki73/traefik-real-ip/pkg/providers"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+const (
+	// ProviderGeneric reads X-Real-Ip and X-Forwarded-For, it is always consulted last.
+	ProviderGeneric = "generic"
+	// ProviderCloudflare reads CF-Connecting-IP and True-Client-IP.
+	ProviderCloudflare = "cloudflare"
+	// ProviderQrator reads X-Qrator-IP-Source.
+	ProviderQrator = "qrator"
+)
+
+var (
+	// ErrUnresolved is returned when none of the consulted providers determined the real IP address.
+	ErrUnresolved = errors.New("real ip could not be resolved")
+	// ErrUntrustedPeer is returned when the connection peer is not allowed to send forwarding headers.
+	ErrUntrustedPeer = errors.New("peer is not allowed to send forwarding headers")
+)
+
+// _providers holds the names of the supported providers.
+var _providers = []string{ProviderGeneric, ProviderCloudflare, ProviderQrator}
+
+// _bogonCategories holds the network sets filtered by default, as the Traefik plugin does.
+var _bogonCategories = []string{"unspecified", "broadcast", "multicast", "documentation", "reserved"}
+
+// Options holds the configuration of the resolver. Matchers which are not set match nothing,
+// so the zero value filters no bogon and applies no limit: start from DefaultOptions instead.
+type Options struct {
+	// Exclusions holds the networks and addresses which are never the real IP address.
+	Exclusions *cidr.Matcher
+	// ProviderExclusions holds the exclusions of the providers which do not use Exclusions, by provider name.
+	ProviderExclusions map[string]*cidr.Matcher
+	// Bogons holds the networks whose addresses are not valid client addresses.
+	Bogons *cidr.Matcher
+	// TrustedNetworks holds the networks of the peers allowed to send forwarding headers, every peer is trusted if empty.
+	TrustedNetworks *cidr.Matcher
+	// Limits holds the limits of the inspected headers.
+	Limits providers.Limits
+	// Duplicates is one of the providers.DuplicateAction* constants, the first line is used if empty.
+	Duplicates string
+	// PreferredProvider is the provider consulted before the generic one, none if empty.
+	PreferredProvider string
+}
+
+// DefaultOptions returns the options the Traefik plugin uses unless configured otherwise:
+// every bogon category is filtered, the header limits apply and every peer is trusted.
+func DefaultOptions() Options {
+	bogons := cidr.NewMatcher()
+	for _, category := range _bogonCategories {
+		prefixes, _ := networks.Lookup(category)
+		bogons.InsertAll(prefixes, "bogonFilter:"+category)
+	}
+
+	return Options{
+		Exclusions: cidr.NewMatcher(),
+		Bogons:     bogons,
+		Limits:     providers.DefaultLimits(),
+		Duplicates: providers.DuplicateActionFirst,
+	}
+}
+
+// NewMatcher creates a matcher of the networks in CIDR notation and the built-in network sets, such as private or cloudflare.
+// Matched entries are labelled with the label, followed by the name of the set for sets.
+func NewMatcher(values []string, label string) (*cidr.Matcher, error) {
+	matcher := cidr.NewMatcher()
+
+	if err := InsertNetworks(matcher, values, label); err != nil {
+		return nil, err
+	}
+
+	return matcher, nil
+}
+
+// InsertNetworks inserts the networks in CIDR notation and the built-in network sets into the matcher.
+func InsertNetworks(matcher *cidr.Matcher, values []string, label string) error {
+	for _, value := range values {
+		if prefixes, ok := networks.Lookup(value); ok {
+			matcher.InsertAll(prefixes, label+":"+value)
+			continue
+		}
+
+		network, err := netip.ParsePrefix(value)
+		if err != nil {
+			return fmt.Errorf(
+				"network %s is neither in CIDR notation nor one of the following sets: %s",
+				value,
+				strings.Join(networks.Names(), ", "),
+			)
+		}
+		matcher.Insert(network, label)
+	}
+
+	return nil
+}
+
+// Result describes the real IP address of the client and how it was determined.
+type Result struct {
+	// IP is the real IP address of the client, the peer address if the peer is not trusted,
+	// and invalid if it could not be determined.
+	IP netip.Addr
+	// Port is the port of the client, zero if the header did not contain one.
+	Port uint16
+	// Provider is the name of the provider which determined the real IP address.
+	Provider string
+	// Header is the name of the header the real IP address was taken from.
+	Header string
+	// Peer is the address of the connection peer, invalid if it could not be parsed.
+	Peer netip.Addr
+	// Trusted is true if the connection peer is allowed to send forwarding headers.
+	Trusted bool
+	// Source is the result of the provider which determined the real IP address, nil if none did.
+	Source *providers.Result
+	// Consulted holds the results of every consulted provider, in order.
+	Consulted []*providers.Result
+}
+
+// IsResolved returns true if the real IP address was determined.
+func (result Result) IsResolved() bool {
+	return result.Source != nil
+}
+
+// Resolver determines the real IP address of clients, consulting the preferred provider first and the generic one as a fallback.
+// It is safe for concurrent use.
+type Resolver struct {
+	generic           *providers.GenericProvider
+	cloudflare        *providers.CloudflareProvider
+	qrator            *providers.QratorProvider
+	trustedNetworks   *cidr.Matcher
+	preferredProvider string
+}
+
+// Providers returns the names of the supported providers.
+func Providers() []string {
+	names := make([]string, len(_providers))
+	copy(names, _providers)
+	return names
+}
+
+// New creates the resolver.
+func New(options Options) (*Resolver, error) {
+	if options.PreferredProvider != "" && !isProvider(options.PreferredProvider) {
+		return nil, fmt.Errorf(
+			"preferred provider %s is not valid, only the following ones are supported: %s",
+			options.PreferredProvider,
+			strings.Join(_providers, ", "),
+		)
+	}
+
+	names := make([]string, 0, len(options.ProviderExclusions))
+	for name := range options.ProviderExclusions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !isProvider(name) {
+			return nil, fmt.Errorf(
+				"provider exclusions %s are not valid, only the following providers are supported: %s",
+				name,
+				strings.Join(_providers, ", "),
+			)
+		}
+	}
+
+	return &Resolver{
+		generic:           providers.InitializeGenericProvider(options.providerOptions(ProviderGeneric)),
+		cloudflare:        providers.InitializeCloudflareProvider(options.providerOptions(ProviderCloudflare)),
+		qrator:            providers.InitializeQratorProvider(options.providerOptions(ProviderQrator)),
+		trustedNetworks:   options.TrustedNetworks,
+		preferredProvider: options.PreferredProvider,
+	}, nil
+}
+
+// providerOptions returns the options of the provider.
+func (options Options) providerOptions(provider string) providers.Options {
+	exclusions := options.Exclusions
+	if providerExclusions, ok := options.ProviderExclusions[provider]; ok {
+		exclusions = providerExclusions
+	}
+
+	return providers.Options{
+		Exclusions: exclusions,
+		Bogons:     options.Bogons,
+		Limits:     options.Limits,
+		Duplicates: options.Duplicates,
+	}
+}
+
+// Resolve determines the real IP address of the client of the request.
+// Every provider is consulted for untrusted peers, so the result describes the headers they sent,
+// but their values are ignored: the peer address is the IP of the result and ErrUntrustedPeer is returned.
+// When no provider determined it, ErrUnresolved is returned along with the result,
+// which still describes the peer and the consulted providers.
+func (resolver *Resolver) Resolve(request *http.Request) (Result, error) {
+	peer := ParsePeerIP(request.RemoteAddr)
+
+	result := Result{
+		Peer:      peer,
+		Trusted:   resolver.isTrusted(peer),
+		Consulted: make([]*providers.Result, 0, 2),
+	}
+
+	switch resolver.preferredProvider {
+	case ProviderCloudflare:
+		result.Consulted = append(result.Consulted, resolver.cloudflare.Resolve(request))
+	case ProviderQrator:
+		result.Consulted = append(result.Consulted, resolver.qrator.Resolve(request))
+	}
+
+	// Every provider is consulted for untrusted peers, so the result describes all the forwarding headers they sent.
+	if !result.Trusted {
+		if resolver.preferredProvider != ProviderCloudflare {
+			result.Consulted = append(result.Consulted, resolver.cloudflare.Resolve(request))
+		}
+		if resolver.preferredProvider != ProviderQrator {
+			result.Consulted = append(result.Consulted, resolver.qrator.Resolve(request))
+		}
+	}
+
+	result.Consulted = append(result.Consulted, resolver.generic.Resolve(request))
+
+	if !result.Trusted {
+		result.IP = peer
+		return result, ErrUntrustedPeer
+	}
+
+	for _, consulted := range result.Consulted {
+		if consulted.IsResolved() {
+			result.IP = consulted.IP
+			result.Port = consulted.Port
+			result.Provider = consulted.Provider
+			result.Header = consulted.Header
+			result.Source = consulted
+			return result, nil
+		}
+	}
+
+	return result, ErrUnresolved
+}
+
+// IsTrustedPeer returns true if the connection peer is allowed to send forwarding headers.
+// When no trusted networks are configured, every peer is trusted.
+func (resolver *Resolver) IsTrustedPeer(remoteAddr string) bool {
+	if resolver.trustedNetworks.Len() == 0 {
+		return true
+	}
+
+	return resolver.isTrusted(ParsePeerIP(remoteAddr))
+}
+
+// isTrusted returns true if the peer is allowed to send forwarding headers.
+func (resolver *Resolver) isTrusted(peer netip.Addr) bool {
+	if resolver.trustedNetworks.Len() == 0 {
+		return true
+	}
+
+	if !peer.IsValid() {
+		return false
+	}
+
+	return resolver.trustedNetworks.Contains(peer)
+}
+
+// Generic returns the generic provider.
+func (resolver *Resolver) Generic() *providers.GenericProvider {
+	return resolver.generic
+}
+
+// Cloudflare returns the Cloudflare provider.
+func (resolver *Resolver) Cloudflare() *providers.CloudflareProvider {
+	return resolver.cloudflare
+}
+
+// Qrator returns the Qrator provider.
+func (resolver *Resolver) Qrator() *providers.QratorProvider {
+	return resolver.qrator
+}
+
+// PreferredProvider returns the provider consulted before the generic one, empty if none.
+func (resolver *Resolver) PreferredProvider() string {
+	return resolver.preferredProvider
+}
+
+// isProvider returns true if the provider is supported.
+func isProvider(provider string) bool {
+	for _, name := range _providers {
+		if name == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePeerIP returns the IP address of the connection peer from the remote address of the request,
+// invalid if it can not be parsed.
+func ParsePeerIP(remoteAddr string) netip.Addr {
+	address, err := providers.ParseAddress(remoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	return address.Addr()
+}
@@ -0,0 +1,267 @@
+package resolver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/darki73/traefik-real-ip/pkg/cidr"
+	"github.com/darki73/traefik-real-ip/pkg/providers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMatcher(label string, prefixes ...string) *cidr.Matcher {
+	matcher := cidr.NewMatcher()
+	for _, prefix := range prefixes {
+		matcher.Insert(netip.MustParsePrefix(prefix), label)
+	}
+	return matcher
+}
+
+// ipString returns the IP address as a string, empty if it is not valid.
+func ipString(ip netip.Addr) string {
+	if !ip.IsValid() {
+		return ""
+	}
+	return ip.String()
+}
+
+func TestResolve(framework *testing.T) {
+	framework.Parallel()
+
+	testCases := []struct {
+		description      string
+		options          Options
+		remoteAddr       string
+		headers          map[string]string
+		expectedIP       string
+		expectedPort     uint16
+		expectedProvider string
+		expectedHeader   string
+		expectedTrusted  bool
+		expectedConsults int
+		expectedError    error
+	}{
+		{
+			description:      "X-Forwarded-For should be resolved without options",
+			remoteAddr:       "10.0.0.1:1234",
+			headers:          map[string]string{"X-Forwarded-For": "8.8.8.8, 10.0.0.2"},
+			expectedIP:       "8.8.8.8",
+			expectedProvider: ProviderGeneric,
+			expectedHeader:   "X-Forwarded-For",
+			expectedTrusted:  true,
+			expectedConsults: 1,
+		},
+		{
+			description:      "Excluded networks should be skipped",
+			options:          Options{Exclusions: newMatcher("excluded", "10.0.0.0/8")},
+			remoteAddr:       "10.0.0.1:1234",
+			headers:          map[string]string{"X-Forwarded-For": "10.0.0.2, [2001:4860::1]:443"},
+			expectedIP:       "2001:4860::1",
+			expectedPort:     443,
+			expectedProvider: ProviderGeneric,
+			expectedHeader:   "X-Forwarded-For",
+			expectedTrusted:  true,
+			expectedConsults: 1,
+		},
+		{
+			description:      "Preferred provider should be consulted first",
+			options:          Options{PreferredProvider: ProviderCloudflare},
+			remoteAddr:       "10.0.0.1:1234",
+			headers:          map[string]string{"CF-Connecting-IP": "1.1.1.1", "X-Forwarded-For": "8.8.8.8"},
+			expectedIP:       "1.1.1.1",
+			expectedProvider: ProviderCloudflare,
+			expectedHeader:   "CF-Connecting-IP",
+			expectedTrusted:  true,
+			expectedConsults: 2,
+		},
+		{
+			description:      "Generic provider should be the fallback of the preferred one",
+			options:          Options{PreferredProvider: ProviderQrator},
+			remoteAddr:       "10.0.0.1:1234",
+			headers:          map[string]string{"X-Forwarded-For": "8.8.8.8"},
+			expectedIP:       "8.8.8.8",
+			expectedProvider: ProviderGeneric,
+			expectedHeader:   "X-Forwarded-For",
+			expectedTrusted:  true,
+			expectedConsults: 2,
+		},
+		{
+			description:      "Provider exclusions should replace the global ones",
+			options:          Options{Exclusions: newMatcher("excluded", "8.8.8.0/24"), ProviderExclusions: map[string]*cidr.Matcher{ProviderGeneric: cidr.NewMatcher()}},
+			remoteAddr:       "10.0.0.1:1234",
+			headers:          map[string]string{"X-Forwarded-For": "8.8.8.8"},
+			expectedIP:       "8.8.8.8",
+			expectedProvider: ProviderGeneric,
+			expectedHeader:   "X-Forwarded-For",
+			expectedTrusted:  true,
+			expectedConsults: 1,
+		},
+		{
+			description:      "Forwarding headers of peers outside of trusted networks should be ignored",
+			options:          Options{TrustedNetworks: newMatcher("trusted", "10.0.0.0/8")},
+			remoteAddr:       "192.168.0.1:1234",
+			headers:          map[string]string{"X-Forwarded-For": "8.8.8.8"},
+			expectedIP:       "192.168.0.1",
+			expectedTrusted:  false,
+			expectedConsults: 3,
+			expectedError:    ErrUntrustedPeer,
+		},
+		{
+			description:      "Bogons should never be resolved",
+			options:          Options{Bogons: newMatcher("bogon", "0.0.0.0/8")},
+			remoteAddr:       "10.0.0.1:1234",
+			headers:          map[string]string{"X-Forwarded-For": "0.0.0.0"},
+			expectedTrusted:  true,
+			expectedConsults: 1,
+			expectedError:    ErrUnresolved,
+		},
+		{
+			description:      "Requests without forwarding headers should not be resolved",
+			options:          Options{TrustedNetworks: newMatcher("trusted", "10.0.0.0/8")},
+			remoteAddr:       "10.0.0.1:1234",
+			expectedTrusted:  true,
+			expectedConsults: 1,
+			expectedError:    ErrUnresolved,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			resolver, err := New(test.options)
+			require.NoError(framework, err)
+
+			request := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+			request.RemoteAddr = test.remoteAddr
+			for key, value := range test.headers {
+				request.Header.Set(key, value)
+			}
+
+			result, err := resolver.Resolve(request)
+
+			assert.ErrorIs(framework, err, test.expectedError)
+			assert.Equal(framework, test.expectedTrusted, result.Trusted)
+			assert.Equal(framework, netip.MustParseAddrPort(test.remoteAddr).Addr(), result.Peer)
+			assert.Len(framework, result.Consulted, test.expectedConsults)
+
+			if test.expectedError != nil {
+				assert.False(framework, result.IsResolved())
+				assert.Equal(framework, test.expectedIP, ipString(result.IP))
+				return
+			}
+
+			require.True(framework, result.IsResolved())
+			assert.Equal(framework, test.expectedIP, result.IP.String())
+			assert.Equal(framework, test.expectedPort, result.Port)
+			assert.Equal(framework, test.expectedProvider, result.Provider)
+			assert.Equal(framework, test.expectedHeader, result.Header)
+			assert.Equal(framework, result.IP, result.Source.IP)
+		})
+	}
+}
+
+func TestResolveLimits(framework *testing.T) {
+	resolver, err := New(Options{
+		Limits: providers.Limits{MaxChainLength: 2, Action: providers.LimitActionIgnore},
+	})
+	require.NoError(framework, err)
+
+	request := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	request.Header.Set("X-Forwarded-For", "8.8.8.8, 8.8.4.4, 1.1.1.1")
+
+	result, err := resolver.Resolve(request)
+
+	assert.ErrorIs(framework, err, ErrUnresolved)
+	require.Len(framework, result.Consulted, 1)
+	assert.True(framework, result.Consulted[0].HasExceeded())
+}
+
+func TestNew(framework *testing.T) {
+	_, err := New(Options{PreferredProvider: "unknown"})
+	assert.EqualError(framework, err, "preferred provider unknown is not valid, only the following ones are supported: generic, cloudflare, qrator")
+
+	_, err = New(Options{ProviderExclusions: map[string]*cidr.Matcher{"unknown": cidr.NewMatcher()}})
+	assert.EqualError(framework, err, "provider exclusions unknown are not valid, only the following providers are supported: generic, cloudflare, qrator")
+
+	assert.Equal(framework, []string{ProviderGeneric, ProviderCloudflare, ProviderQrator}, Providers())
+}
+
+func TestIsTrustedPeer(framework *testing.T) {
+	resolver, err := New(Options{TrustedNetworks: newMatcher("trusted", "10.0.0.0/8")})
+	require.NoError(framework, err)
+
+	assert.True(framework, resolver.IsTrustedPeer("10.0.0.1:1234"))
+	assert.False(framework, resolver.IsTrustedPeer("192.168.0.1:1234"))
+	assert.False(framework, resolver.IsTrustedPeer("invalid"))
+
+	resolver, err = New(Options{})
+	require.NoError(framework, err)
+
+	assert.True(framework, resolver.IsTrustedPeer("invalid"))
+}
+
+func TestDefaultOptions(framework *testing.T) {
+	framework.Parallel()
+
+	request := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	request.Header.Set("X-Real-Ip", "0.0.0.0")
+
+	resolver, err := New(Options{})
+	require.NoError(framework, err)
+
+	result, err := resolver.Resolve(request)
+	require.NoError(framework, err)
+	assert.Equal(framework, "0.0.0.0", ipString(result.IP))
+
+	resolver, err = New(DefaultOptions())
+	require.NoError(framework, err)
+
+	result, err = resolver.Resolve(request)
+	assert.ErrorIs(framework, err, ErrUnresolved)
+	assert.Equal(framework, "", ipString(result.IP))
+	assert.Equal(framework, providers.DefaultLimits(), DefaultOptions().Limits)
+}
+
+func TestNewMatcher(framework *testing.T) {
+	framework.Parallel()
+
+	matcher, err := NewMatcher([]string{"private", "8.8.8.0/24"}, "trustedNetworks")
+	require.NoError(framework, err)
+
+	assert.True(framework, matcher.Contains(netip.MustParseAddr("10.0.0.1")))
+	assert.True(framework, matcher.Contains(netip.MustParseAddr("8.8.8.8")))
+	assert.False(framework, matcher.Contains(netip.MustParseAddr("1.1.1.1")))
+
+	_, err = NewMatcher([]string{"invalid"}, "trustedNetworks")
+	assert.ErrorContains(framework, err, "network invalid is neither in CIDR notation nor one of the following sets")
+}
+
+func TestParsePeerIP(framework *testing.T) {
+	framework.Parallel()
+
+	assert.Equal(framework, "10.0.0.1", ipString(ParsePeerIP("10.0.0.1:1234")))
+	assert.Equal(framework, "2001:db8::1", ipString(ParsePeerIP("[2001:db8::1]:1234")))
+	assert.Equal(framework, "", ipString(ParsePeerIP("invalid")))
+}
+
+func BenchmarkResolve(benchmark *testing.B) {
+	resolver, err := New(Options{Exclusions: newMatcher("excluded", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16")})
+	if err != nil {
+		benchmark.Fatal(err)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	request.Header.Set("X-Forwarded-For", "10.0.0.1, 172.16.0.1, 192.168.0.1, 8.8.8.8")
+
+	benchmark.ReportAllocs()
+	benchmark.ResetTimer()
+
+	for index := 0; index < benchmark.N; index++ {
+		_, _ = resolver.Resolve(request)
+	}
+}
@@ -0,0 +1,138 @@
+package traefik_real_ip
+
+import (
+	"fmt"
+	"github.com/darki73/traefik-real-ip/pkg/ratelimit"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// RateLimitConfig holds the configuration of the rate limiter keyed by the real IP.
+// Rate limiting is disabled unless average is set.
+type RateLimitConfig struct {
+	Average    int    `json:"average,omitempty" toml:"average,omitempty" yaml:"average,omitempty"`
+	Period     string `json:"period,omitempty" toml:"period,omitempty" yaml:"period,omitempty"`
+	Burst      int    `json:"burst,omitempty" toml:"burst,omitempty" yaml:"burst,omitempty"`
+	IPv4Prefix int    `json:"ipv4Prefix,omitempty" toml:"ipv4Prefix,omitempty" yaml:"ipv4Prefix,omitempty"`
+	IPv6Prefix int    `json:"ipv6Prefix,omitempty" toml:"ipv6Prefix,omitempty" yaml:"ipv6Prefix,omitempty"`
+	MaxEntries int    `json:"maxEntries,omitempty" toml:"maxEntries,omitempty" yaml:"maxEntries,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty" toml:"statusCode,omitempty" yaml:"statusCode,omitempty"`
+}
+
+// CreateRateLimitConfig creates the default rate limit configuration, with rate limiting disabled.
+func CreateRateLimitConfig() *RateLimitConfig {
+	return &RateLimitConfig{
+		Average:    0,
+		Period:     "1s",
+		Burst:      1,
+		IPv4Prefix: 32,
+		IPv6Prefix: 64,
+		MaxEntries: 10000,
+		StatusCode: http.StatusTooManyRequests,
+	}
+}
+
+// newRateLimitConfig validates the rate limit configuration and fills in the defaults.
+func newRateLimitConfig(config *RateLimitConfig) (*RateLimitConfig, error) {
+	rateLimit := CreateRateLimitConfig()
+
+	if config == nil {
+		return rateLimit, nil
+	}
+
+	if config.Average < 0 {
+		return nil, fmt.Errorf("rate limit average %d is not valid, it must not be negative", config.Average)
+	}
+	rateLimit.Average = config.Average
+
+	if config.Period != "" {
+		period, err := time.ParseDuration(config.Period)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit period %s is not valid: %w", config.Period, err)
+		}
+		if period <= 0 {
+			return nil, fmt.Errorf("rate limit period %s is not valid, it must be positive", config.Period)
+		}
+		rateLimit.Period = config.Period
+	}
+
+	if config.Burst < 0 {
+		return nil, fmt.Errorf("rate limit burst %d is not valid, it must not be negative", config.Burst)
+	}
+	if config.Burst != 0 {
+		rateLimit.Burst = config.Burst
+	}
+
+	if config.IPv4Prefix != 0 {
+		if config.IPv4Prefix < 0 || config.IPv4Prefix > 32 {
+			return nil, fmt.Errorf("rate limit IPv4 prefix %d is not valid, it must be between 1 and 32", config.IPv4Prefix)
+		}
+		rateLimit.IPv4Prefix = config.IPv4Prefix
+	}
+
+	if config.IPv6Prefix != 0 {
+		if config.IPv6Prefix < 0 || config.IPv6Prefix > 128 {
+			return nil, fmt.Errorf("rate limit IPv6 prefix %d is not valid, it must be between 1 and 128", config.IPv6Prefix)
+		}
+		rateLimit.IPv6Prefix = config.IPv6Prefix
+	}
+
+	if config.MaxEntries < 0 {
+		return nil, fmt.Errorf("rate limit max entries %d is not valid, it must not be negative", config.MaxEntries)
+	}
+	if config.MaxEntries != 0 {
+		rateLimit.MaxEntries = config.MaxEntries
+	}
+
+	if config.StatusCode != 0 {
+		if config.StatusCode < 400 || config.StatusCode > 599 {
+			return nil, fmt.Errorf("rate limit status code %d is not valid, only 4xx and 5xx codes are supported", config.StatusCode)
+		}
+		rateLimit.StatusCode = config.StatusCode
+	}
+
+	return rateLimit, nil
+}
+
+// newRateLimiter creates the rate limiter, or returns nil if rate limiting is disabled.
+func newRateLimiter(config *RateLimitConfig) *ratelimit.Limiter {
+	if config.Average == 0 {
+		return nil
+	}
+
+	period, _ := time.ParseDuration(config.Period)
+
+	return ratelimit.New(ratelimit.Options{
+		Rate:       float64(config.Average) / period.Seconds(),
+		Burst:      config.Burst,
+		IPv4Prefix: config.IPv4Prefix,
+		IPv6Prefix: config.IPv6Prefix,
+		MaxEntries: config.MaxEntries,
+	})
+}
+
+// allowRate consumes a token for the client and rejects the request if the client exceeded its rate.
+// It returns false if the request was rejected and must not be passed to the next handler.
+func (trip *TraefikRealIP) allowRate(responseWriter http.ResponseWriter, ip netip.Addr) bool {
+	if trip.rateLimiter == nil || !ip.IsValid() {
+		return true
+	}
+
+	allowed, retryAfter := trip.rateLimiter.Allow(ip)
+	if allowed {
+		return true
+	}
+
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	responseWriter.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(responseWriter, http.StatusText(trip.rateLimit.StatusCode), trip.rateLimit.StatusCode)
+
+	return false
+}
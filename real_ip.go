@@ -2,20 +2,45 @@ package traefik_real_ip
 
 import (
 	"context"
-	"fmt"
-	"github.com/darki73/traefik-real-ip/pkg/providers"
-	"net"
+	"errors"
+	"github.com/darki73/traefik-real-ip/pkg/audit"
+	"github.com/darki73/traefik-real-ip/pkg/cidr"
+	"github.com/darki73/traefik-real-ip/pkg/logger"
+	"github.com/darki73/traefik-real-ip/pkg/ratelimit"
+	"github.com/darki73/traefik-real-ip/pkg/resolver"
 	"net/http"
-	"strings"
+	"net/netip"
+	"strconv"
 	"sync"
 )
 
 // Config holds configuration passed to the plugin.
 type Config struct {
-	ExcludedNetworks  []string `json:"excludedNetworks,omitempty" toml:"excludedNetworks,omitempty" yaml:"excludedNetworks,omitempty"`
-	ExcludedAddresses []string `json:"excludedAddresses,omitempty" toml:"excludedAddresses,omitempty" yaml:"excludedAddresses,omitempty"`
-	Providers         []string `json:"providers,omitempty" toml:"providers,omitempty" yaml:"providers,omitempty"`
-	PreferredProvider string   `json:"preferredProvider,omitempty" toml:"preferredProvider,omitempty" yaml:"preferredProvider,omitempty"`
+	ExcludedNetworks  []string                   `json:"excludedNetworks,omitempty" toml:"excludedNetworks,omitempty" yaml:"excludedNetworks,omitempty"`
+	ExcludedAddresses []string                   `json:"excludedAddresses,omitempty" toml:"excludedAddresses,omitempty" yaml:"excludedAddresses,omitempty"`
+	Providers         []string                   `json:"providers,omitempty" toml:"providers,omitempty" yaml:"providers,omitempty"`
+	ProviderOptions   map[string]*ProviderConfig `json:"providerOptions,omitempty" toml:"providerOptions,omitempty" yaml:"providerOptions,omitempty"`
+	PreferredProvider string                     `json:"preferredProvider,omitempty" toml:"preferredProvider,omitempty" yaml:"preferredProvider,omitempty"`
+	TrustedNetworks   []string                   `json:"trustedNetworks,omitempty" toml:"trustedNetworks,omitempty" yaml:"trustedNetworks,omitempty"`
+	ProvenanceHeaders bool                       `json:"provenanceHeaders,omitempty" toml:"provenanceHeaders,omitempty" yaml:"provenanceHeaders,omitempty"`
+	Strict            bool                       `json:"strict,omitempty" toml:"strict,omitempty" yaml:"strict,omitempty"`
+	StrictStatusCode  int                        `json:"strictStatusCode,omitempty" toml:"strictStatusCode,omitempty" yaml:"strictStatusCode,omitempty"`
+	StrictBody        string                     `json:"strictBody,omitempty" toml:"strictBody,omitempty" yaml:"strictBody,omitempty"`
+	Spoofing          *SpoofingConfig            `json:"spoofing,omitempty" toml:"spoofing,omitempty" yaml:"spoofing,omitempty"`
+	Allow             []string                   `json:"allow,omitempty" toml:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny              []string                   `json:"deny,omitempty" toml:"deny,omitempty" yaml:"deny,omitempty"`
+	DeniedStatusCode  int                        `json:"deniedStatusCode,omitempty" toml:"deniedStatusCode,omitempty" yaml:"deniedStatusCode,omitempty"`
+	RateLimit         *RateLimitConfig           `json:"rateLimit,omitempty" toml:"rateLimit,omitempty" yaml:"rateLimit,omitempty"`
+	BogonFilter       *BogonFilterConfig         `json:"bogonFilter,omitempty" toml:"bogonFilter,omitempty" yaml:"bogonFilter,omitempty"`
+	Limits            *LimitsConfig              `json:"limits,omitempty" toml:"limits,omitempty" yaml:"limits,omitempty"`
+	DuplicateHeaders  *DuplicateHeadersConfig    `json:"duplicateHeaders,omitempty" toml:"duplicateHeaders,omitempty" yaml:"duplicateHeaders,omitempty"`
+	Cache             *CacheConfig               `json:"cache,omitempty" toml:"cache,omitempty" yaml:"cache,omitempty"`
+	LogLevel          string                     `json:"logLevel,omitempty" toml:"logLevel,omitempty" yaml:"logLevel,omitempty"`
+	Logging           *LoggingConfig             `json:"logging,omitempty" toml:"logging,omitempty" yaml:"logging,omitempty"`
+	Metrics           *MetricsConfig             `json:"metrics,omitempty" toml:"metrics,omitempty" yaml:"metrics,omitempty"`
+	Explain           *ExplainConfig             `json:"explain,omitempty" toml:"explain,omitempty" yaml:"explain,omitempty"`
+	Audit             *AuditConfig               `json:"audit,omitempty" toml:"audit,omitempty" yaml:"audit,omitempty"`
+	Tracing           *TracingConfig             `json:"tracing,omitempty" toml:"tracing,omitempty" yaml:"tracing,omitempty"`
 }
 
 // CreateConfig creates the default plugin configuration if no parameters are passed.
@@ -24,7 +49,28 @@ func CreateConfig() *Config {
 		ExcludedNetworks:  []string{},
 		ExcludedAddresses: []string{},
 		Providers:         []string{},
+		ProviderOptions:   map[string]*ProviderConfig{},
 		PreferredProvider: "",
+		TrustedNetworks:   []string{},
+		ProvenanceHeaders: false,
+		Strict:            false,
+		StrictStatusCode:  http.StatusForbidden,
+		StrictBody:        "",
+		Spoofing:          CreateSpoofingConfig(),
+		Allow:             []string{},
+		Deny:              []string{},
+		DeniedStatusCode:  http.StatusForbidden,
+		RateLimit:         CreateRateLimitConfig(),
+		BogonFilter:       CreateBogonFilterConfig(),
+		Limits:            CreateLimitsConfig(),
+		DuplicateHeaders:  CreateDuplicateHeadersConfig(),
+		Cache:             CreateCacheConfig(),
+		LogLevel:          "",
+		Logging:           CreateLoggingConfig(),
+		Metrics:           CreateMetricsConfig(),
+		Explain:           CreateExplainConfig(),
+		Audit:             CreateAuditConfig(),
+		Tracing:           CreateTracingConfig(),
 	}
 }
 
@@ -32,72 +78,179 @@ func CreateConfig() *Config {
 type TraefikRealIP struct {
 	next               http.Handler
 	name               string
-	excludedNetworks   []*net.IPNet
-	excludedAddresses  []net.IP
+	exclusions         *cidr.Matcher
+	providerExclusions map[string]*cidr.Matcher
+	bogons             *cidr.Matcher
+	limits             *LimitsConfig
+	duplicateHeaders   *DuplicateHeadersConfig
 	availableProviders []string
-	genericProvider    *providers.GenericProvider
-	cloudflareProvider *providers.CloudflareProvider
-	qratorProvider     *providers.QratorProvider
-	preferredProvider  string
+	resolver           *resolver.Resolver
+	trustedNetworks    *cidr.Matcher
+	provenanceHeaders  bool
+	strict             bool
+	strictStatusCode   int
+	strictBody         string
+	spoofing           *SpoofingConfig
+	allowedNetworks    *cidr.Matcher
+	deniedNetworks     *cidr.Matcher
+	deniedStatusCode   int
+	rateLimit          *RateLimitConfig
+	rateLimiter        *ratelimit.Limiter
+	cache              *resolutionCache
+	logger             *logger.Logger
+	metrics            *resolutionMetrics
+	explainConfig      *ExplainConfig
+	auditSink          *audit.AsyncSink
+	tracing            *TracingConfig
 	providersIPs       map[string]string
 	mutex              sync.Mutex
 }
 
+const (
+	_provenanceProviderHeader = "X-Real-IP-Provider"
+	_provenanceSourceHeader   = "X-Real-IP-Source-Header"
+	_provenanceTrustedHeader  = "X-Real-IP-Trusted"
+	_provenanceTrustUnknown   = "unknown"
+)
+
 // New instantiates and returns the required components used to handle HTTP request.
 func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	trip := &TraefikRealIP{
 		next:               next,
 		name:               name,
-		availableProviders: []string{"generic", "cloudflare", "qrator"},
-		preferredProvider:  config.PreferredProvider,
+		availableProviders: _availableProviders,
+		provenanceHeaders:  config.ProvenanceHeaders,
+		strict:             config.Strict,
+		strictStatusCode:   config.StrictStatusCode,
+		strictBody:         config.StrictBody,
+		deniedStatusCode:   config.DeniedStatusCode,
 		providersIPs:       make(map[string]string),
 	}
 
-	for _, value := range config.ExcludedNetworks {
-		_, excludedNetwork, err := net.ParseCIDR(value)
-		if err != nil {
-			return nil, err
-		}
-		trip.excludedNetworks = append(trip.excludedNetworks, excludedNetwork)
+	if trip.strictStatusCode == 0 {
+		trip.strictStatusCode = http.StatusForbidden
 	}
 
-	for _, value := range config.ExcludedAddresses {
-		ip := net.ParseIP(value)
+	if trip.strictBody == "" {
+		trip.strictBody = http.StatusText(trip.strictStatusCode)
+	}
 
-		if ip != nil {
-			trip.excludedAddresses = append(trip.excludedAddresses, ip)
-		}
+	log, err := newLogger(config.loggingConfig())
+	if err != nil {
+		return nil, err
 	}
+	trip.logger = log
 
-	if config.PreferredProvider != "" {
-		if !trip.IsValidProvider(config.PreferredProvider) {
-			return nil, fmt.Errorf(
-				"preferred provider %s is not valid, only the following ones are supported: %s",
-				config.PreferredProvider,
-				strings.Join(trip.availableProviders, ", "),
-			)
-		}
+	metrics, err := newResolutionMetrics(config.Metrics, name)
+	if err != nil {
+		return nil, err
 	}
+	trip.metrics = metrics
 
-	trip.genericProvider = providers.InitializeGenericProvider(trip.GetExcludedNetworks(), trip.GetExcludedAddresses())
+	trip.explainConfig = newExplainConfig(config.Explain)
 
-	for _, provider := range config.Providers {
-		if !trip.IsValidProvider(provider) {
-			return nil, fmt.Errorf("provider %s is not valid, only the following ones are supported: %s", provider, strings.Join(trip.availableProviders, ", "))
-		}
+	tracing, err := newTracingConfig(config.Tracing)
+	if err != nil {
+		return nil, err
 	}
+	trip.tracing = tracing
 
-	if config.Providers != nil || len(config.Providers) == 0 {
-		trip.cloudflareProvider = providers.InitializeCloudflareProvider(trip.GetExcludedNetworks(), trip.GetExcludedAddresses())
-		trip.qratorProvider = providers.InitializeQratorProvider(trip.GetExcludedNetworks(), trip.GetExcludedAddresses())
-	} else {
-		if trip.ConfigHasProvider("cloudflare", config.Providers) {
-			trip.cloudflareProvider = providers.InitializeCloudflareProvider(trip.GetExcludedNetworks(), trip.GetExcludedAddresses())
-		}
+	spoofing, err := newSpoofingConfig(config.Spoofing)
+	if err != nil {
+		return nil, err
+	}
+	trip.spoofing = spoofing
 
-		if trip.ConfigHasProvider("qrator", config.Providers) {
-			trip.qratorProvider = providers.InitializeQratorProvider(trip.GetExcludedNetworks(), trip.GetExcludedAddresses())
-		}
+	rateLimit, err := newRateLimitConfig(config.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+	trip.rateLimit = rateLimit
+	trip.rateLimiter = newRateLimiter(rateLimit)
+
+	limits, err := newLimitsConfig(config.Limits)
+	if err != nil {
+		return nil, err
+	}
+	trip.limits = limits
+
+	duplicateHeaders, err := newDuplicateHeadersConfig(config.DuplicateHeaders)
+	if err != nil {
+		return nil, err
+	}
+	trip.duplicateHeaders = duplicateHeaders
+
+	exclusions, err := resolver.NewMatcher(config.ExcludedNetworks, "excludedNetworks")
+	if err != nil {
+		return nil, err
+	}
+	trip.exclusions = exclusions
+	trip.bogons = newBogonMatcher(config.BogonFilter)
+
+	trustedNetworks, err := resolver.NewMatcher(config.TrustedNetworks, "trustedNetworks")
+	if err != nil {
+		return nil, err
+	}
+	trip.trustedNetworks = trustedNetworks
+
+	allowedNetworks, err := resolver.NewMatcher(config.Allow, "allow")
+	if err != nil {
+		return nil, err
+	}
+	trip.allowedNetworks = allowedNetworks
+
+	deniedNetworks, err := resolver.NewMatcher(config.Deny, "deny")
+	if err != nil {
+		return nil, err
+	}
+	trip.deniedNetworks = deniedNetworks
+
+	if trip.deniedStatusCode == 0 {
+		trip.deniedStatusCode = http.StatusForbidden
+	}
+
+	insertAddresses(trip.exclusions, config.ExcludedAddresses, "excludedAddresses")
+
+	providerExclusions, err := trip.newProviderExclusions(config)
+	if err != nil {
+		return nil, err
+	}
+	trip.providerExclusions = providerExclusions
+
+	realIPResolver, err := resolver.New(resolver.Options{
+		Exclusions:         trip.exclusions,
+		ProviderExclusions: trip.providerExclusions,
+		Bogons:             trip.bogons,
+		TrustedNetworks:    trip.trustedNetworks,
+		Limits:             trip.getProviderLimits(),
+		Duplicates:         trip.duplicateHeaders.Action,
+		PreferredProvider:  config.PreferredProvider,
+	})
+	if err != nil {
+		return nil, err
+	}
+	trip.resolver = realIPResolver
+
+	cache, err := newResolutionCache(config.Cache, trip.getCacheHeaders())
+	if err != nil {
+		return nil, err
+	}
+	trip.cache = cache
+
+	// The audit sink is opened last, so no other step can fail after it was opened.
+	auditSink, err := newAuditSink(config.Audit)
+	if err != nil {
+		return nil, err
+	}
+	trip.auditSink = auditSink
+	// The handler is keyed by the middleware name, so a reloaded middleware replaces its own handler
+	// and every middleware sharing the sink logs its errors with its own logger.
+	if auditSink != nil {
+		auditSink.SetErrorHandler(name, trip.logAuditError)
 	}
 
 	return trip, nil
@@ -105,49 +258,245 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 
 // ServeHTTP handles the HTTP request.
 func (trip *TraefikRealIP) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
-	realIP := ""
+	if trip.metrics.serve(responseWriter, request) {
+		return
+	}
 
-	if trip.HasPreferredProvider() {
-		if trip.GetPreferredProvider() == "cloudflare" {
-			realIP = trip.cloudflareProvider.GetRealIP(request)
-		}
-		if trip.GetPreferredProvider() == "qrator" {
-			realIP = trip.qratorProvider.GetRealIP(request)
-		}
+	if trip.isExplainRequest(request) {
+		trip.explain(responseWriter, request)
+		return
+	}
+
+	trip.handle(responseWriter, request, trip.next)
+}
+
+// handle determines the real IP of the client, applies every check and passes the request to the next handler.
+// It returns the resolution along with the reason the request was rejected, empty if it was passed to the next handler.
+func (trip *TraefikRealIP) handle(responseWriter http.ResponseWriter, request *http.Request, next http.Handler) (*resolution, string) {
+	res := trip.resolve(request)
+	trip.logResolution(request, res)
+	trip.metrics.observeResolution(res)
+
+	if trip.isOverLimits(res) {
+		trip.metrics.observeRejected(_rejectedLimits)
+		http.Error(responseWriter, http.StatusText(trip.limits.StatusCode), trip.limits.StatusCode)
+		return res, _rejectedLimits
+	}
+
+	if trip.isDuplicateRejected(res) {
+		trip.metrics.observeRejected(_rejectedDuplicateHeaders)
+		http.Error(responseWriter, http.StatusText(trip.duplicateHeaders.StatusCode), trip.duplicateHeaders.StatusCode)
+		return res, _rejectedDuplicateHeaders
+	}
+
+	if !trip.handleSpoofing(responseWriter, request, res) {
+		trip.metrics.observeRejected(_rejectedSpoofing)
+		return res, _rejectedSpoofing
+	}
+
+	if trip.strict && res.strictViolation() != "" {
+		trip.metrics.observeRejected(_rejectedStrict)
+		http.Error(responseWriter, trip.strictBody, trip.strictStatusCode)
+		return res, _rejectedStrict
+	}
+
+	clientIP := trip.clientIP(request, res)
+
+	if !trip.IsAllowedClient(clientIP) {
+		trip.metrics.observeRejected(_rejectedDenied)
+		http.Error(responseWriter, http.StatusText(trip.deniedStatusCode), trip.deniedStatusCode)
+		return res, _rejectedDenied
 	}
 
-	if realIP == "" {
-		realIP = trip.genericProvider.GetRealIP(request)
+	if !trip.allowRate(responseWriter, clientIP) {
+		trip.metrics.observeRejected(_rejectedRateLimited)
+		return res, _rejectedRateLimited
 	}
 
-	if realIP != "" {
+	trip.auditResolution(request, res)
+
+	// Forwarding headers of untrusted peers are replaced by the peer address, or removed if it could not be parsed,
+	// so they never reach the next handler.
+	if realIP := res.realIP(); realIP.IsValid() {
+		trip.mutex.Lock()
+		value := realIP.String()
+		request.Header.Set("X-Forwarded-For", value)
+		request.Header.Set("X-Real-Ip", value)
+		trip.mutex.Unlock()
+	} else if !res.trusted {
 		trip.mutex.Lock()
-		request.Header.Set("X-Forwarded-For", realIP)
-		request.Header.Set("X-Real-Ip", realIP)
+		request.Header.Del("X-Forwarded-For")
+		request.Header.Del("X-Real-Ip")
 		trip.mutex.Unlock()
 	}
 
-	trip.next.ServeHTTP(responseWriter, request)
+	if trip.provenanceHeaders {
+		trip.setProvenanceHeaders(request, res)
+	}
+
+	if trip.tracing.isEnabled() {
+		trip.setTraceContext(request, res)
+	}
+
+	next.ServeHTTP(responseWriter, request)
+
+	return res, ""
+}
+
+// resolve determines the real IP of the client, using the cached resolution of identical requests if caching is enabled.
+// Resolutions of requests whose headers exceeded the limits are never cached.
+func (trip *TraefikRealIP) resolve(request *http.Request) *resolution {
+	if trip.cache == nil {
+		return trip.resolveRequest(request)
+	}
+
+	key := trip.cache.key(request)
+	res, ok := trip.cache.get(key)
+	trip.metrics.observeCache(ok)
+	if ok {
+		return res
+	}
+
+	res = trip.resolveRequest(request)
+	if !res.hasExceeded() {
+		trip.cache.add(key, res)
+	}
+
+	return res
+}
+
+// resolveRequest determines the real IP of the client with the resolver.
+// Unresolved requests and untrusted peers are outcomes the resolution describes, any other error is logged.
+func (trip *TraefikRealIP) resolveRequest(request *http.Request) *resolution {
+	result, err := trip.resolver.Resolve(request)
+
+	if err != nil && !errors.Is(err, resolver.ErrUnresolved) && !errors.Is(err, resolver.ErrUntrustedPeer) {
+		trip.logger.Log(
+			logger.LevelError,
+			"unable to resolve the real ip",
+			logger.Field{Key: "name", Value: trip.name},
+			logger.Field{Key: "peer", Value: request.RemoteAddr},
+			logger.Field{Key: "error", Value: err.Error()},
+		)
+	}
+
+	return &resolution{
+		result:    result.Source,
+		consulted: result.Consulted,
+		trusted:   result.Trusted,
+		peer:      result.Peer,
+	}
+}
+
+// setProvenanceHeaders sets the headers describing how the real IP was determined.
+// Values sent by the client are always removed, so they can not be spoofed.
+func (trip *TraefikRealIP) setProvenanceHeaders(request *http.Request, res *resolution) {
+	trip.mutex.Lock()
+	defer trip.mutex.Unlock()
+
+	request.Header.Del(_provenanceProviderHeader)
+	request.Header.Del(_provenanceSourceHeader)
+	request.Header.Del(_provenanceTrustedHeader)
+
+	if !res.realIP().IsValid() && res.trusted {
+		return
+	}
+
+	if res.realIP().IsValid() {
+		request.Header.Set(_provenanceProviderHeader, res.realIPProvider())
+	}
+	if header := res.realIPHeader(); header != "" {
+		request.Header.Set(_provenanceSourceHeader, header)
+	}
+
+	request.Header.Set(_provenanceTrustedHeader, trip.describeTrust(res))
 }
 
-// GetExcludedNetworks returns list of excluded networks.
-func (trip *TraefikRealIP) GetExcludedNetworks() []*net.IPNet {
-	return trip.excludedNetworks
+// describeTrust returns the value of the trusted provenance header, unknown if no trusted networks are configured,
+// as every peer is then allowed to send forwarding headers without being verified.
+func (trip *TraefikRealIP) describeTrust(res *resolution) string {
+	if trip.trustedNetworks.Len() == 0 {
+		return _provenanceTrustUnknown
+	}
+
+	return strconv.FormatBool(res.trusted)
+}
+
+// GetExclusions returns the matcher of excluded networks and addresses.
+func (trip *TraefikRealIP) GetExclusions() *cidr.Matcher {
+	return trip.exclusions
+}
+
+// GetBogons returns the matcher of addresses which are never accepted as the real IP.
+func (trip *TraefikRealIP) GetBogons() *cidr.Matcher {
+	return trip.bogons
+}
+
+// GetTrustedNetworks returns the matcher of trusted networks.
+func (trip *TraefikRealIP) GetTrustedNetworks() *cidr.Matcher {
+	return trip.trustedNetworks
+}
+
+// IsTrustedPeer returns true if the connection peer is allowed to supply forwarding headers.
+// When no trusted networks are configured, every peer is trusted.
+func (trip *TraefikRealIP) IsTrustedPeer(remoteAddr string) bool {
+	return trip.resolver.IsTrustedPeer(remoteAddr)
+}
+
+// GetResolver returns the resolver determining the real IP of the clients.
+func (trip *TraefikRealIP) GetResolver() *resolver.Resolver {
+	return trip.resolver
+}
+
+// GetAllowedNetworks returns the matcher of networks clients are allowed from.
+func (trip *TraefikRealIP) GetAllowedNetworks() *cidr.Matcher {
+	return trip.allowedNetworks
 }
 
-// GetExcludedAddresses returns list of excluded addresses.
-func (trip *TraefikRealIP) GetExcludedAddresses() []net.IP {
-	return trip.excludedAddresses
+// GetDeniedNetworks returns the matcher of networks clients are denied from.
+func (trip *TraefikRealIP) GetDeniedNetworks() *cidr.Matcher {
+	return trip.deniedNetworks
+}
+
+// IsAllowedClient returns true if the client IP passes the allow and deny lists.
+// Deny list takes precedence, and an empty allow list allows every client which is not denied.
+func (trip *TraefikRealIP) IsAllowedClient(ip netip.Addr) bool {
+	if trip.GetAllowedNetworks().Len() == 0 && trip.GetDeniedNetworks().Len() == 0 {
+		return true
+	}
+
+	if !ip.IsValid() {
+		return false
+	}
+
+	if trip.GetDeniedNetworks().Contains(ip) {
+		return false
+	}
+
+	if trip.GetAllowedNetworks().Len() == 0 {
+		return true
+	}
+
+	return trip.GetAllowedNetworks().Contains(ip)
+}
+
+// clientIP returns the real IP, or the connection peer address if it could not be resolved.
+func (trip *TraefikRealIP) clientIP(request *http.Request, res *resolution) netip.Addr {
+	if realIP := res.realIP(); realIP.IsValid() {
+		return realIP
+	}
+
+	return resolver.ParsePeerIP(request.RemoteAddr)
 }
 
 // GetPreferredProvider returns preferred provider.
 func (trip *TraefikRealIP) GetPreferredProvider() string {
-	return trip.preferredProvider
+	return trip.resolver.PreferredProvider()
 }
 
 // HasPreferredProvider returns true if preferred provider is set.
 func (trip *TraefikRealIP) HasPreferredProvider() bool {
-	return trip.preferredProvider != ""
+	return trip.resolver.PreferredProvider() != ""
 }
 
 // IsValidProvider returns true if provider is valid.
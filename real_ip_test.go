@@ -1,11 +1,20 @@
 package traefik_real_ip
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/darki73/traefik-real-ip/pkg/audit"
+	"github.com/darki73/traefik-real-ip/pkg/logger"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -28,8 +37,9 @@ func TestNewTraefikRealIP(framework *testing.T) {
 			expectedError: true,
 		},
 		{
-			description: "CreateConfig should return an error if an invalid excluded address is passed.",
-			config:      &Config{ExcludedAddresses: []string{"invalid"}},
+			description:   "CreateConfig should return an error if an invalid excluded address is passed.",
+			config:        &Config{ExcludedAddresses: []string{"invalid"}},
+			expectedError: true,
 		},
 		{
 			description:   "CreateConfig should return an error if an invalid preferred provider is passed.",
@@ -131,6 +141,22 @@ func TestNewTraefikRealIP(framework *testing.T) {
 			},
 			expectedIP: "10.0.0.20",
 		},
+		{
+			description: "X-Real-Ip or X-Forwarded-For headers should be present with ports, brackets and unknown identifiers stripped",
+			config:      &Config{},
+			inputHeaders: map[string]string{
+				"X-Forwarded-For": "unknown, \"[2001:4860::1]:443\", 8.8.8.8:1234",
+			},
+			expectedIP: "2001:4860::1",
+		},
+		{
+			description: "X-Real-Ip or X-Forwarded-For headers should be present with the port of the client stripped",
+			config:      &Config{},
+			inputHeaders: map[string]string{
+				"X-Real-Ip": "8.8.8.8:51234",
+			},
+			expectedIP: "8.8.8.8",
+		},
 	}
 
 	for _, test := range testCases {
@@ -168,6 +194,1945 @@ func TestNewTraefikRealIP(framework *testing.T) {
 	}
 }
 
+func TestNamedNetworkSets(framework *testing.T) {
+	testCases := []struct {
+		description    string
+		config         *Config
+		remoteAddr     string
+		inputHeaders   map[string]string
+		expectedError  bool
+		expectedStatus int
+		expectedIP     string
+	}{
+		{
+			description:   "New should return an error if an unknown network set is passed",
+			config:        &Config{ExcludedNetworks: []string{"unknown"}},
+			expectedError: true,
+		},
+		{
+			description:    "Named sets should be expanded in excluded networks",
+			config:         &Config{ExcludedNetworks: []string{"private", "loopback"}},
+			inputHeaders:   map[string]string{"X-Forwarded-For": "127.0.0.1, 10.0.0.1, fd00::1, 8.8.8.8"},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "8.8.8.8",
+		},
+		{
+			description:    "Named sets should be mixed with networks in CIDR notation",
+			config:         &Config{ExcludedNetworks: []string{"cgnat", "8.8.8.0/24"}},
+			inputHeaders:   map[string]string{"X-Forwarded-For": "100.64.0.1, 8.8.8.8, 1.1.1.1"},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "1.1.1.1",
+		},
+		{
+			description:    "Named sets should be expanded in denied networks",
+			config:         &Config{Deny: []string{"bogon"}},
+			inputHeaders:   map[string]string{"X-Real-Ip": "10.0.0.1"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			description:    "Named sets should be expanded in trusted networks",
+			config:         &Config{Strict: true, TrustedNetworks: []string{"cloudflare"}},
+			remoteAddr:     "[2606:4700::1]:443",
+			inputHeaders:   map[string]string{"X-Real-Ip": "8.8.8.8"},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "8.8.8.8",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+			trip, err := New(context.Background(), next, test.config, "traefik-real-ip")
+
+			if test.expectedError {
+				assert.Error(framework, err)
+				return
+			}
+			require.NoError(framework, err)
+
+			recorder := httptest.NewRecorder()
+			request := newTestRequest(framework, test.remoteAddr, test.inputHeaders)
+
+			trip.ServeHTTP(recorder, request)
+
+			assert.Equal(framework, test.expectedStatus, recorder.Code)
+			if test.expectedIP != "" {
+				assertHeader(framework, request, "X-Real-Ip", test.expectedIP)
+			}
+		})
+	}
+}
+
+func TestBogonFilter(framework *testing.T) {
+	forwardedFor := "0.0.0.0, 255.255.255.255, 224.0.0.1, ff02::1, 192.0.2.1, 2001:db8::1, ::, 240.0.0.1, 198.18.0.1, 8.8.8.8"
+
+	testCases := []struct {
+		description  string
+		bogonFilter  *BogonFilterConfig
+		inputHeaders map[string]string
+		expectedIP   string
+	}{
+		{
+			description:  "Bogon addresses should be skipped by default",
+			inputHeaders: map[string]string{"X-Forwarded-For": forwardedFor},
+			expectedIP:   "8.8.8.8",
+		},
+		{
+			description:  "Bogon X-Real-Ip should fall back to X-Forwarded-For",
+			inputHeaders: map[string]string{"X-Real-Ip": "203.0.113.7", "X-Forwarded-For": "8.8.8.8"},
+			expectedIP:   "8.8.8.8",
+		},
+		{
+			description:  "Disabled bogon categories should be accepted",
+			bogonFilter:  &BogonFilterConfig{Documentation: newBool(false)},
+			inputHeaders: map[string]string{"X-Forwarded-For": forwardedFor},
+			expectedIP:   "192.0.2.1",
+		},
+		{
+			description:  "Categories left out of the configuration should stay filtered",
+			bogonFilter:  &BogonFilterConfig{},
+			inputHeaders: map[string]string{"X-Forwarded-For": forwardedFor},
+			expectedIP:   "8.8.8.8",
+		},
+		{
+			description: "Every category should be accepted when every category is disabled",
+			bogonFilter: &BogonFilterConfig{
+				Unspecified:   newBool(false),
+				Broadcast:     newBool(false),
+				Multicast:     newBool(false),
+				Documentation: newBool(false),
+				Reserved:      newBool(false),
+			},
+			inputHeaders: map[string]string{"X-Forwarded-For": forwardedFor},
+			expectedIP:   "0.0.0.0",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			config := CreateConfig()
+			if test.bogonFilter != nil {
+				config.BogonFilter = test.bogonFilter
+			}
+
+			next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+			trip, err := New(context.Background(), next, config, "traefik-real-ip")
+			require.NoError(framework, err)
+
+			recorder := httptest.NewRecorder()
+			request := newTestRequest(framework, "", test.inputHeaders)
+
+			trip.ServeHTTP(recorder, request)
+
+			assertHeader(framework, request, "X-Real-Ip", test.expectedIP)
+		})
+	}
+}
+
+func TestLimits(framework *testing.T) {
+	longChain := "0.0.0.0, 255.255.255.255, 224.0.0.1, 8.8.8.8"
+
+	testCases := []struct {
+		description    string
+		limits         *LimitsConfig
+		inputHeaders   map[string]string
+		inputLines     []string
+		expectedError  bool
+		expectedStatus int
+		expectedIP     string
+	}{
+		{
+			description:   "New should return an error if an invalid limits action is passed",
+			limits:        &LimitsConfig{Action: "invalid"},
+			expectedError: true,
+		},
+		{
+			description:    "Chains within the limits should be inspected completely",
+			limits:         &LimitsConfig{MaxChainLength: 4},
+			inputHeaders:   map[string]string{"X-Forwarded-For": longChain},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "8.8.8.8",
+		},
+		{
+			description:    "Chains exceeding the length limit should be truncated",
+			limits:         &LimitsConfig{MaxChainLength: 2, Action: "truncate"},
+			inputHeaders:   map[string]string{"X-Forwarded-For": "1.1.1.1, 8.8.8.8, 8.8.4.4"},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "1.1.1.1",
+		},
+		{
+			description:    "Chains exceeding the length limit should be ignored",
+			limits:         &LimitsConfig{MaxChainLength: 3, Action: "ignore"},
+			inputHeaders:   map[string]string{"X-Forwarded-For": longChain, "X-Real-Ip": "1.1.1.1"},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "1.1.1.1",
+		},
+		{
+			description:    "Chains exceeding the length limit should be rejected with the configured status",
+			limits:         &LimitsConfig{MaxChainLength: 3, Action: "reject", StatusCode: http.StatusBadRequest},
+			inputHeaders:   map[string]string{"X-Forwarded-For": longChain},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			description:    "Headers exceeding the byte limit should be truncated to complete elements",
+			limits:         &LimitsConfig{MaxHeaderBytes: 20, Action: "truncate"},
+			inputHeaders:   map[string]string{"X-Forwarded-For": "10.0.0.1, 1.1.1.1, 8.8.8.8"},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "10.0.0.1",
+		},
+		{
+			description:    "Single value headers exceeding the byte limit should be ignored even when truncating",
+			limits:         &LimitsConfig{MaxHeaderBytes: 10, Action: "truncate"},
+			inputHeaders:   map[string]string{"X-Real-Ip": "2001:4860::1", "X-Forwarded-For": "8.8.8.8"},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "8.8.8.8",
+		},
+		{
+			description:    "Headers exceeding the byte limit should be rejected with the default status",
+			limits:         &LimitsConfig{MaxHeaderBytes: 5, Action: "reject"},
+			inputHeaders:   map[string]string{"X-Real-Ip": "1.1.1.1"},
+			expectedStatus: http.StatusRequestHeaderFieldsTooLarge,
+		},
+		{
+			description:    "Headers exceeding the lines limit should be rejected",
+			limits:         &LimitsConfig{MaxHeaderLines: 2, Action: "reject"},
+			inputLines:     []string{"1.1.1.1", "8.8.8.8", "8.8.4.4"},
+			expectedStatus: http.StatusRequestHeaderFieldsTooLarge,
+		},
+		{
+			description:    "Headers exceeding the lines limit should be ignored",
+			limits:         &LimitsConfig{MaxHeaderLines: 2, Action: "ignore"},
+			inputLines:     []string{"1.1.1.1", "8.8.8.8", "8.8.4.4"},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+			trip, err := New(context.Background(), next, &Config{Limits: test.limits}, "traefik-real-ip")
+
+			if test.expectedError {
+				assert.Error(framework, err)
+				return
+			}
+			require.NoError(framework, err)
+
+			recorder := httptest.NewRecorder()
+			request := newTestRequest(framework, "", test.inputHeaders)
+			for _, line := range test.inputLines {
+				request.Header.Add("X-Forwarded-For", line)
+			}
+
+			trip.ServeHTTP(recorder, request)
+
+			assert.Equal(framework, test.expectedStatus, recorder.Code)
+			if test.expectedStatus == http.StatusOK {
+				assertHeader(framework, request, "X-Real-Ip", test.expectedIP)
+			}
+		})
+	}
+}
+
+func TestProviderExclusions(framework *testing.T) {
+	testCases := []struct {
+		description     string
+		config          *Config
+		inputHeaders    map[string]string
+		expectedError   bool
+		expectedIP      string
+		expectedLabel   string
+		labelledAddress string
+	}{
+		{
+			description: "New should return an error if options for an unknown provider are passed",
+			config: &Config{
+				ProviderOptions: map[string]*ProviderConfig{"akamai": {ExcludedNetworks: []string{"private"}}},
+			},
+			expectedError: true,
+		},
+		{
+			description: "New should return an error if an invalid provider network is passed",
+			config: &Config{
+				ProviderOptions: map[string]*ProviderConfig{"generic": {ExcludedNetworks: []string{"invalid"}}},
+			},
+			expectedError: true,
+		},
+		{
+			description: "Provider exclusions should only apply to their provider",
+			config: &Config{
+				PreferredProvider: "cloudflare",
+				ProviderOptions:   map[string]*ProviderConfig{"generic": {ExcludedNetworks: []string{"10.0.0.0/8"}}},
+			},
+			inputHeaders: map[string]string{"CF-Connecting-IP": "10.0.0.1", "X-Forwarded-For": "10.0.0.2, 1.1.1.1"},
+			expectedIP:   "10.0.0.1",
+		},
+		{
+			description: "Provider exclusions should be merged with the global exclusions",
+			config: &Config{
+				ExcludedNetworks: []string{"10.0.0.0/8"},
+				ProviderOptions:  map[string]*ProviderConfig{"generic": {ExcludedAddresses: []string{"1.1.1.1"}}},
+			},
+			inputHeaders:    map[string]string{"X-Forwarded-For": "10.0.0.1, 1.1.1.1, 8.8.8.8"},
+			expectedIP:      "8.8.8.8",
+			expectedLabel:   "providerOptions.generic.excludedAddresses",
+			labelledAddress: "1.1.1.1",
+		},
+		{
+			description: "Provider exclusions should take precedence over global exclusions of the same network",
+			config: &Config{
+				ExcludedNetworks: []string{"10.0.0.0/8"},
+				ProviderOptions:  map[string]*ProviderConfig{"generic": {ExcludedNetworks: []string{"10.0.0.0/8"}}},
+			},
+			inputHeaders:    map[string]string{"X-Forwarded-For": "10.0.0.1, 8.8.8.8"},
+			expectedIP:      "8.8.8.8",
+			expectedLabel:   "providerOptions.generic.excludedNetworks",
+			labelledAddress: "10.0.0.1",
+		},
+		{
+			description: "Provider exclusions should override the global exclusions",
+			config: &Config{
+				ExcludedNetworks: []string{"10.0.0.0/8"},
+				ProviderOptions: map[string]*ProviderConfig{
+					"generic": {ExcludedNetworks: []string{"172.16.0.0/12"}, Override: true},
+				},
+			},
+			inputHeaders: map[string]string{"X-Forwarded-For": "172.16.0.1, 10.0.0.1, 8.8.8.8"},
+			expectedIP:   "10.0.0.1",
+		},
+		{
+			description: "Providers without options should use the global exclusions",
+			config: &Config{
+				ExcludedNetworks:  []string{"10.0.0.0/8"},
+				PreferredProvider: "cloudflare",
+				ProviderOptions:   map[string]*ProviderConfig{"generic": {Override: true}},
+			},
+			inputHeaders: map[string]string{"CF-Connecting-IP": "10.0.0.1", "X-Forwarded-For": "10.0.0.2, 1.1.1.1"},
+			expectedIP:   "10.0.0.2",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+			handler, err := New(context.Background(), next, test.config, "traefik-real-ip")
+
+			if test.expectedError {
+				assert.Error(framework, err)
+				return
+			}
+			require.NoError(framework, err)
+
+			trip := handler.(*TraefikRealIP)
+			if test.expectedLabel != "" {
+				entry, ok := trip.GetProviderExclusions("generic").Lookup(netip.MustParseAddr(test.labelledAddress))
+				assert.True(framework, ok)
+				assert.Equal(framework, test.expectedLabel, entry.Label)
+			}
+
+			recorder := httptest.NewRecorder()
+			request := newTestRequest(framework, "", test.inputHeaders)
+
+			trip.ServeHTTP(recorder, request)
+
+			assertHeader(framework, request, "X-Real-Ip", test.expectedIP)
+		})
+	}
+}
+
+func TestDuplicateHeaders(framework *testing.T) {
+	testCases := []struct {
+		description      string
+		preferred        string
+		duplicateHeaders *DuplicateHeadersConfig
+		inputLines       map[string][]string
+		expectedError    bool
+		expectedStatus   int
+		expectedIP       string
+	}{
+		{
+			description:      "New should return an error if an invalid duplicate headers action is passed",
+			duplicateHeaders: &DuplicateHeadersConfig{Action: "invalid"},
+			expectedError:    true,
+		},
+		{
+			description:    "X-Forwarded-For lines should be merged in order",
+			inputLines:     map[string][]string{"X-Forwarded-For": {"0.0.0.0, 10.0.0.1", "1.1.1.1"}},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "10.0.0.1",
+		},
+		{
+			description:    "X-Forwarded-For lines should be merged skipping empty lines",
+			inputLines:     map[string][]string{"X-Forwarded-For": {"", "0.0.0.0", " ", "1.1.1.1"}},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "1.1.1.1",
+		},
+		{
+			description:      "X-Forwarded-For lines should be merged even when duplicates are rejected",
+			duplicateHeaders: &DuplicateHeadersConfig{Action: "reject"},
+			inputLines:       map[string][]string{"X-Forwarded-For": {"1.1.1.1", "8.8.8.8"}},
+			expectedStatus:   http.StatusOK,
+			expectedIP:       "1.1.1.1",
+		},
+		{
+			description:    "Duplicated single value headers should use the first line by default",
+			preferred:      "cloudflare",
+			inputLines:     map[string][]string{"CF-Connecting-IP": {"1.1.1.1", "8.8.8.8"}},
+			expectedStatus: http.StatusOK,
+			expectedIP:     "1.1.1.1",
+		},
+		{
+			description:      "Duplicated single value headers should use the last line",
+			preferred:        "cloudflare",
+			duplicateHeaders: &DuplicateHeadersConfig{Action: "last"},
+			inputLines:       map[string][]string{"CF-Connecting-IP": {"1.1.1.1", "8.8.8.8"}},
+			expectedStatus:   http.StatusOK,
+			expectedIP:       "8.8.8.8",
+		},
+		{
+			description:      "Duplicated single value headers should be ignored",
+			preferred:        "cloudflare",
+			duplicateHeaders: &DuplicateHeadersConfig{Action: "ignore"},
+			inputLines:       map[string][]string{"CF-Connecting-IP": {"1.1.1.1", "8.8.8.8"}, "X-Forwarded-For": {"8.8.4.4"}},
+			expectedStatus:   http.StatusOK,
+			expectedIP:       "8.8.4.4",
+		},
+		{
+			description:      "Duplicated single value headers should be rejected with the default status",
+			preferred:        "cloudflare",
+			duplicateHeaders: &DuplicateHeadersConfig{Action: "reject"},
+			inputLines:       map[string][]string{"CF-Connecting-IP": {"1.1.1.1", "8.8.8.8"}},
+			expectedStatus:   http.StatusBadRequest,
+		},
+		{
+			description:      "Duplicated X-Real-Ip headers should be rejected with the configured status",
+			duplicateHeaders: &DuplicateHeadersConfig{Action: "reject", StatusCode: http.StatusForbidden},
+			inputLines:       map[string][]string{"X-Real-Ip": {"1.1.1.1", "1.1.1.1"}},
+			expectedStatus:   http.StatusForbidden,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			config := &Config{PreferredProvider: test.preferred, DuplicateHeaders: test.duplicateHeaders}
+			next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+			trip, err := New(context.Background(), next, config, "traefik-real-ip")
+
+			if test.expectedError {
+				assert.Error(framework, err)
+				return
+			}
+			require.NoError(framework, err)
+
+			recorder := httptest.NewRecorder()
+			request := newTestRequest(framework, "", nil)
+			for header, lines := range test.inputLines {
+				for _, line := range lines {
+					request.Header.Add(header, line)
+				}
+			}
+
+			trip.ServeHTTP(recorder, request)
+
+			assert.Equal(framework, test.expectedStatus, recorder.Code)
+			if test.expectedStatus == http.StatusOK {
+				assertHeader(framework, request, "X-Real-Ip", test.expectedIP)
+			}
+		})
+	}
+}
+
+func TestResolutionCache(framework *testing.T) {
+	framework.Run("New should return an error if negative max entries are passed", func(framework *testing.T) {
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+		_, err := New(context.Background(), next, &Config{Cache: &CacheConfig{MaxEntries: -1}}, "traefik-real-ip")
+		assert.Error(framework, err)
+	})
+
+	framework.Run("Cache should be disabled by default", func(framework *testing.T) {
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+		handler, err := New(context.Background(), next, CreateConfig(), "traefik-real-ip")
+		require.NoError(framework, err)
+
+		trip := handler.(*TraefikRealIP)
+		trip.ServeHTTP(httptest.NewRecorder(), newTestRequest(framework, "10.0.0.1:1234", map[string]string{"X-Real-Ip": "1.1.1.1"}))
+
+		assert.Equal(framework, CacheStats{}, trip.GetCacheStats())
+	})
+
+	framework.Run("Identical requests should be resolved from the cache", func(framework *testing.T) {
+		config := &Config{PreferredProvider: "cloudflare", Cache: &CacheConfig{MaxEntries: 2}}
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+		handler, err := New(context.Background(), next, config, "traefik-real-ip")
+		require.NoError(framework, err)
+
+		trip := handler.(*TraefikRealIP)
+		requests := []struct {
+			remoteAddr string
+			headers    map[string]string
+			expectedIP string
+		}{
+			{"10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "1.1.1.1"}, "1.1.1.1"},
+			{"10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "1.1.1.1"}, "1.1.1.1"},
+			{"10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "1.1.1.1", "Accept": "text/html"}, "1.1.1.1"},
+			{"10.0.0.2:1234", map[string]string{"CF-Connecting-IP": "1.1.1.1"}, "1.1.1.1"},
+			{"10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "8.8.8.8"}, "8.8.8.8"},
+			{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "8.8.4.4"}, "8.8.4.4"},
+			{"10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "1.1.1.1"}, "1.1.1.1"},
+		}
+
+		for _, input := range requests {
+			request := newTestRequest(framework, input.remoteAddr, input.headers)
+			trip.ServeHTTP(httptest.NewRecorder(), request)
+			assertHeader(framework, request, "X-Real-Ip", input.expectedIP)
+		}
+
+		assert.Equal(framework, CacheStats{Hits: 2, Misses: 5, Entries: 2}, trip.GetCacheStats())
+	})
+
+	framework.Run("Provider headers of untrusted peers should not reuse cached resolutions", func(framework *testing.T) {
+		config := &Config{
+			TrustedNetworks: []string{"172.16.0.0/12"},
+			Spoofing:        &SpoofingConfig{UntrustedProviderHeader: _spoofingActionBlock},
+			Cache:           &CacheConfig{MaxEntries: 100},
+		}
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+		handler, err := New(context.Background(), next, config, "traefik-real-ip")
+		require.NoError(framework, err)
+
+		trip := handler.(*TraefikRealIP)
+
+		recorder := httptest.NewRecorder()
+		trip.ServeHTTP(recorder, newTestRequest(framework, "192.168.1.1:1234", nil))
+		assert.Equal(framework, http.StatusOK, recorder.Code)
+
+		recorder = httptest.NewRecorder()
+		trip.ServeHTTP(recorder, newTestRequest(framework, "192.168.1.1:1234", map[string]string{"CF-Connecting-IP": "1.1.1.1"}))
+		assert.Equal(framework, http.StatusForbidden, recorder.Code)
+
+		assert.Equal(framework, CacheStats{Hits: 0, Misses: 2, Entries: 2}, trip.GetCacheStats())
+	})
+
+	framework.Run("Requests whose headers exceeded the limits should not be cached", func(framework *testing.T) {
+		config := &Config{Cache: &CacheConfig{MaxEntries: 2}, Limits: &LimitsConfig{MaxChainLength: 1}}
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+		handler, err := New(context.Background(), next, config, "traefik-real-ip")
+		require.NoError(framework, err)
+
+		trip := handler.(*TraefikRealIP)
+		for index := 0; index < 2; index++ {
+			request := newTestRequest(framework, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.1.1.1, 8.8.8.8"})
+			trip.ServeHTTP(httptest.NewRecorder(), request)
+			assertHeader(framework, request, "X-Real-Ip", "1.1.1.1")
+		}
+
+		assert.Equal(framework, CacheStats{Hits: 0, Misses: 2, Entries: 0}, trip.GetCacheStats())
+	})
+}
+
+func TestLogging(framework *testing.T) {
+	testCases := []struct {
+		description   string
+		logging       *LoggingConfig
+		inputHeaders  map[string]string
+		expectedError bool
+		expectedLine  string
+		expectedCount int
+	}{
+		{
+			description:   "New should return an error if an invalid log level is passed",
+			logging:       &LoggingConfig{Level: "trace"},
+			expectedError: true,
+		},
+		{
+			description:   "New should return an error if an invalid log output is passed",
+			logging:       &LoggingConfig{Output: "/var/log/real-ip.log"},
+			expectedError: true,
+		},
+		{
+			description:   "Resolutions should not be logged by default",
+			inputHeaders:  map[string]string{"X-Real-Ip": "1.1.1.1"},
+			expectedCount: 0,
+		},
+		{
+			description:  "Resolutions should be logged with the rejected candidates and the winning provider",
+			logging:      &LoggingConfig{Level: "debug", Format: "logfmt"},
+			inputHeaders: map[string]string{"X-Forwarded-For": "10.0.0.1, unknown, 1.1.1.1"},
+			expectedLine: `level=debug msg="real ip resolved" name=traefik-real-ip peer=192.0.2.1:1234 trusted=true ` +
+				`headers="X-Forwarded-For=10.0.0.1, unknown, 1.1.1.1" ` +
+				`rejected="X-Forwarded-For: 10.0.0.1 excluded by excludedNetworks:private 10.0.0.0/8,X-Forwarded-For: unknown malformed (unknown identifier)" ` +
+				`provider=generic header=X-Forwarded-For ip=1.1.1.1`,
+			expectedCount: 2,
+		},
+		{
+			description:  "Unresolved requests should be logged",
+			logging:      &LoggingConfig{Level: "debug"},
+			inputHeaders: map[string]string{"X-Real-Ip": "10.0.0.1"},
+			expectedLine: `"level":"debug","msg":"real ip not resolved","name":"traefik-real-ip","peer":"192.0.2.1:1234","trusted":true,` +
+				`"headers":{"X-Real-Ip":"10.0.0.1"},"rejected":["X-Real-Ip: 10.0.0.1 excluded by excludedNetworks:private 10.0.0.0/8"]}`,
+			expectedCount: 2,
+		},
+		{
+			description:   "Resolutions should be sampled",
+			logging:       &LoggingConfig{Level: "debug", Sampling: 2},
+			inputHeaders:  map[string]string{"X-Real-Ip": "1.1.1.1"},
+			expectedLine:  `"msg":"real ip resolved"`,
+			expectedCount: 1,
+		},
+		{
+			description:   "Spoofing attempts should be logged as warnings",
+			logging:       &LoggingConfig{Format: "logfmt"},
+			inputHeaders:  map[string]string{"X-Real-Ip": "1.1.1.1", "X-Forwarded-For": "8.8.8.8"},
+			expectedLine:  `level=warn msg="spoofing suspected" name=traefik-real-ip rule=real-ip-mismatch peer=192.0.2.1:1234`,
+			expectedCount: 2,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			config := &Config{
+				ExcludedNetworks: []string{"private"},
+				Spoofing:         &SpoofingConfig{RealIPMismatch: "log"},
+				Logging:          test.logging,
+			}
+			next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+			handler, err := New(context.Background(), next, config, "traefik-real-ip")
+
+			if test.expectedError {
+				assert.Error(framework, err)
+				return
+			}
+			require.NoError(framework, err)
+
+			trip := handler.(*TraefikRealIP)
+			output := &bytes.Buffer{}
+			trip.logger = newTestLogger(framework, test.logging, output)
+
+			for index := 0; index < 2; index++ {
+				trip.ServeHTTP(httptest.NewRecorder(), newTestRequest(framework, "192.0.2.1:1234", test.inputHeaders))
+			}
+
+			if test.expectedCount == 0 {
+				assert.Empty(framework, output.String())
+				return
+			}
+
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			require.Len(framework, lines, test.expectedCount)
+			for _, line := range lines {
+				assert.Contains(framework, line, test.expectedLine)
+			}
+		})
+	}
+}
+
+func TestLogLevel(framework *testing.T) {
+	framework.Run("Log level should override the level of the logging options", func(framework *testing.T) {
+		config := &Config{LogLevel: "debug", Logging: &LoggingConfig{Level: "warn", Format: "logfmt"}}
+
+		logging := config.loggingConfig()
+
+		assert.Equal(framework, &LoggingConfig{Level: "debug", Format: "logfmt"}, logging)
+		assert.Equal(framework, "warn", config.Logging.Level)
+	})
+
+	framework.Run("Log level should apply without logging options", func(framework *testing.T) {
+		config := &Config{LogLevel: "debug"}
+
+		assert.Equal(framework, "debug", config.loggingConfig().Level)
+	})
+
+	framework.Run("Logging options should be used as they are without log level", func(framework *testing.T) {
+		config := &Config{Logging: &LoggingConfig{Level: "error"}}
+
+		assert.Same(framework, config.Logging, config.loggingConfig())
+	})
+
+	framework.Run("Invalid log level should be reported under its own name", func(framework *testing.T) {
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+		_, err := New(context.Background(), next, &Config{LogLevel: "trace"}, "traefik-real-ip")
+
+		var validationErrors ValidationErrors
+		require.ErrorAs(framework, err, &validationErrors)
+		require.Len(framework, validationErrors, 1)
+		assert.Equal(framework, "logLevel", validationErrors[0].Field)
+	})
+}
+
+func TestMetrics(framework *testing.T) {
+	framework.Run("New should return an error if an invalid allowed network is passed", func(framework *testing.T) {
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+		_, err := New(context.Background(), next, &Config{Metrics: &MetricsConfig{Path: "/metrics", Allow: []string{"invalid"}}}, "traefik-real-ip")
+		assert.Error(framework, err)
+	})
+
+	framework.Run("Metrics path should be passed to the next handler when metrics are disabled", func(framework *testing.T) {
+		called := false
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) { called = true })
+		trip, err := New(context.Background(), next, CreateConfig(), "traefik-real-ip")
+		require.NoError(framework, err)
+
+		request := httptest.NewRequest(http.MethodGet, "http://localhost/metrics", nil)
+		trip.ServeHTTP(httptest.NewRecorder(), request)
+
+		assert.True(framework, called)
+	})
+
+	framework.Run("Metrics should count outcomes per provider, rejection reason and spoofing rule", func(framework *testing.T) {
+		config := &Config{
+			PreferredProvider: "cloudflare",
+			ExcludedNetworks:  []string{"private"},
+			Spoofing:          &SpoofingConfig{RealIPMismatch: "block"},
+			Deny:              []string{"9.9.9.9/32"},
+			Cache:             &CacheConfig{MaxEntries: 10},
+			Metrics:           &MetricsConfig{Path: "/metrics"},
+		}
+		called := false
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) { called = true })
+		trip, err := New(context.Background(), next, config, "real-ip")
+		require.NoError(framework, err)
+
+		requests := []map[string]string{
+			{"CF-Connecting-IP": "1.1.1.1"},
+			{"CF-Connecting-IP": "1.1.1.1"},
+			{"X-Forwarded-For": "10.0.0.1, unknown, 8.8.8.8"},
+			{"X-Real-Ip": "1.1.1.1", "X-Forwarded-For": "8.8.8.8"},
+			{"X-Real-Ip": "9.9.9.9"},
+			{},
+		}
+		for _, headers := range requests {
+			trip.ServeHTTP(httptest.NewRecorder(), newTestRequest(framework, "10.0.0.1:1234", headers))
+		}
+
+		called = false
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "http://localhost/metrics", nil)
+		request.RemoteAddr = "127.0.0.1:1234"
+		trip.ServeHTTP(recorder, request)
+
+		assert.False(framework, called)
+		assert.Equal(framework, http.StatusOK, recorder.Code)
+		assert.Equal(framework, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+
+		body := recorder.Body.String()
+		for _, expected := range []string{
+			`traefik_real_ip_requests_total{name="real-ip",outcome="resolved"} 5`,
+			`traefik_real_ip_requests_total{name="real-ip",outcome="unresolved"} 1`,
+			`traefik_real_ip_provider_results_total{name="real-ip",provider="cloudflare",outcome="absent"} 4`,
+			`traefik_real_ip_provider_results_total{name="real-ip",provider="cloudflare",outcome="resolved"} 2`,
+			`traefik_real_ip_provider_results_total{name="real-ip",provider="generic",outcome="absent"} 3`,
+			`traefik_real_ip_provider_results_total{name="real-ip",provider="generic",outcome="resolved"} 3`,
+			`traefik_real_ip_rejected_candidates_total{name="real-ip",provider="generic",reason="excluded"} 1`,
+			`traefik_real_ip_rejected_candidates_total{name="real-ip",provider="generic",reason="malformed"} 1`,
+			`traefik_real_ip_spoofing_suspected_total{name="real-ip",rule="real-ip-mismatch"} 1`,
+			`traefik_real_ip_rejected_requests_total{name="real-ip",reason="denied"} 1`,
+			`traefik_real_ip_rejected_requests_total{name="real-ip",reason="spoofing"} 1`,
+			`traefik_real_ip_cache_requests_total{name="real-ip",result="hit"} 1`,
+			`traefik_real_ip_cache_requests_total{name="real-ip",result="miss"} 5`,
+		} {
+			assert.Contains(framework, body, expected)
+		}
+	})
+
+	framework.Run("Metrics should be refused to peers outside of the allowed networks", func(framework *testing.T) {
+		config := &Config{Metrics: &MetricsConfig{Path: "/metrics", Allow: []string{"10.0.0.0/8"}}}
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+		trip, err := New(context.Background(), next, config, "real-ip")
+		require.NoError(framework, err)
+
+		for remoteAddr, expectedStatus := range map[string]int{
+			"10.0.0.1:1234":  http.StatusOK,
+			"127.0.0.1:1234": http.StatusForbidden,
+			"":               http.StatusForbidden,
+		} {
+			request := httptest.NewRequest(http.MethodGet, "http://localhost/metrics", nil)
+			request.RemoteAddr = remoteAddr
+			request.Header.Set("X-Real-Ip", "10.0.0.1")
+
+			recorder := httptest.NewRecorder()
+			trip.ServeHTTP(recorder, request)
+
+			assert.Equal(framework, expectedStatus, recorder.Code, remoteAddr)
+		}
+	})
+
+	framework.Run("Metrics should only be served to loopback peers by default", func(framework *testing.T) {
+		config := &Config{Metrics: &MetricsConfig{Path: "/metrics"}}
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+		trip, err := New(context.Background(), next, config, "real-ip")
+		require.NoError(framework, err)
+
+		for remoteAddr, expectedStatus := range map[string]int{
+			"127.0.0.1:1234": http.StatusOK,
+			"[::1]:1234":     http.StatusOK,
+			"10.0.0.5:1234":  http.StatusForbidden,
+		} {
+			request := httptest.NewRequest(http.MethodGet, "http://localhost/metrics", nil)
+			request.RemoteAddr = remoteAddr
+			request.Header.Set("X-Forwarded-For", "1.2.3.4")
+
+			recorder := httptest.NewRecorder()
+			trip.ServeHTTP(recorder, request)
+
+			assert.Equal(framework, expectedStatus, recorder.Code, remoteAddr)
+		}
+	})
+}
+
+func TestExplain(framework *testing.T) {
+	newExplainMiddleware := func(framework *testing.T, config *Config) (http.Handler, *bool) {
+		called := false
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) { called = true })
+		trip, err := New(context.Background(), next, config, "traefik-real-ip")
+		require.NoError(framework, err)
+
+		return trip, &called
+	}
+
+	framework.Run("Explain header should be ignored when explain mode is disabled", func(framework *testing.T) {
+		trip, called := newExplainMiddleware(framework, CreateConfig())
+
+		request := newTestRequest(framework, "10.0.0.1:1234", map[string]string{"X-Real-IP-Explain": ""})
+		trip.ServeHTTP(httptest.NewRecorder(), request)
+
+		assert.True(framework, *called)
+	})
+
+	framework.Run("Requests with a wrong secret should be handled as usual", func(framework *testing.T) {
+		trip, called := newExplainMiddleware(framework, &Config{Explain: &ExplainConfig{Secret: "s3cret"}})
+
+		recorder := httptest.NewRecorder()
+		request := newTestRequest(framework, "10.0.0.1:1234", map[string]string{"X-Real-IP-Explain": "guess", "X-Real-Ip": "1.1.1.1"})
+		trip.ServeHTTP(recorder, request)
+
+		assert.True(framework, *called)
+		assertHeader(framework, request, "X-Real-Ip", "1.1.1.1")
+	})
+
+	framework.Run("Requests with the secret should be answered with the explanation", func(framework *testing.T) {
+		config := &Config{
+			ExcludedNetworks:  []string{"private"},
+			PreferredProvider: "cloudflare",
+			TrustedNetworks:   []string{"10.0.0.0/8"},
+			Explain:           &ExplainConfig{Header: "X-Debug", Secret: "s3cret"},
+		}
+		trip, called := newExplainMiddleware(framework, config)
+
+		recorder := httptest.NewRecorder()
+		request := newTestRequest(framework, "10.0.0.1:1234", map[string]string{
+			"X-Debug":         "s3cret",
+			"X-Forwarded-For": "10.0.0.2, unknown, [2001:4860::1]:443",
+		})
+		trip.ServeHTTP(recorder, request)
+
+		assert.False(framework, *called)
+		assert.Equal(framework, http.StatusOK, recorder.Code)
+		assert.Equal(framework, "application/json", recorder.Header().Get("Content-Type"))
+		assertHeader(framework, request, "X-Real-Ip", "")
+
+		var explanation Explanation
+		require.NoError(framework, json.Unmarshal(recorder.Body.Bytes(), &explanation))
+
+		assert.Equal(framework, Explanation{
+			Name: "traefik-real-ip",
+			Peer: ExplanationPeer{Address: "10.0.0.1:1234", Trusted: true},
+			Providers: []ExplanationProvider{
+				{Provider: "cloudflare", Values: map[string]string{}},
+				{
+					Provider: "generic",
+					Values:   map[string]string{"X-Forwarded-For": "10.0.0.2, unknown, [2001:4860::1]:443"},
+					Rejected: []ExplanationRejection{
+						{Header: "X-Forwarded-For", Value: "10.0.0.2", Reason: "excluded", Network: "10.0.0.0/8", Label: "excludedNetworks:private"},
+						{Header: "X-Forwarded-For", Value: "unknown", Reason: "malformed", Error: `address "unknown" refused: unknown identifier`},
+					},
+					Resolved: true,
+				},
+			},
+			Result: &ExplanationResult{IP: "2001:4860::1", Port: 443, Provider: "generic", Header: "X-Forwarded-For"},
+			Verdict: ExplanationVerdict{
+				Status:    http.StatusOK,
+				Forwarded: map[string]string{"X-Forwarded-For": "2001:4860::1", "X-Real-Ip": "2001:4860::1"},
+			},
+		}, explanation)
+	})
+
+	framework.Run("Explanation should describe the rejection of the request", func(framework *testing.T) {
+		config := &Config{
+			Deny:    []string{"1.1.1.1/32"},
+			Explain: &ExplainConfig{Secret: "s3cret"},
+		}
+		trip, called := newExplainMiddleware(framework, config)
+
+		recorder := httptest.NewRecorder()
+		request := newTestRequest(framework, "10.0.0.1:1234", map[string]string{"X-Real-IP-Explain": "s3cret", "X-Real-Ip": "1.1.1.1"})
+		trip.ServeHTTP(recorder, request)
+
+		assert.False(framework, *called)
+
+		var explanation Explanation
+		require.NoError(framework, json.Unmarshal(recorder.Body.Bytes(), &explanation))
+
+		assert.Equal(framework, ExplanationVerdict{Status: http.StatusForbidden, Rejected: "denied"}, explanation.Verdict)
+		assert.Equal(framework, "1.1.1.1", explanation.Result.IP)
+	})
+}
+
+func TestAudit(framework *testing.T) {
+	testCases := []struct {
+		description     string
+		remoteAddr      string
+		inputHeaders    map[string]string
+		expectedChanges []string
+		expectedIP      string
+		expectedRealIP  string
+	}{
+		{
+			description:  "Requests whose real IP is the connection peer should not be audited",
+			remoteAddr:   "1.1.1.1:1234",
+			inputHeaders: map[string]string{"X-Real-Ip": "1.1.1.1"},
+		},
+		{
+			description:  "Unresolved requests should not be audited",
+			remoteAddr:   "10.0.0.1:1234",
+			inputHeaders: map[string]string{"X-Real-Ip": "unknown"},
+		},
+		{
+			description:     "Requests whose real IP differs from the connection peer should be audited",
+			remoteAddr:      "10.0.0.1:1234",
+			inputHeaders:    map[string]string{"X-Forwarded-For": "1.1.1.1"},
+			expectedChanges: []string{"peer"},
+			expectedIP:      "1.1.1.1",
+		},
+		{
+			description:     "Requests whose real IP differs from the incoming X-Real-Ip should be audited",
+			remoteAddr:      "1.1.1.1:1234",
+			inputHeaders:    map[string]string{"CF-Connecting-IP": "1.1.1.1", "X-Real-Ip": "8.8.8.8"},
+			expectedChanges: []string{"real-ip"},
+			expectedIP:      "1.1.1.1",
+			expectedRealIP:  "8.8.8.8",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			path := filepath.Join(framework.TempDir(), "audit.log")
+			config := &Config{
+				PreferredProvider: "cloudflare",
+				Audit:             &AuditConfig{Sink: "file", Path: path},
+			}
+			next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+			trip, err := New(context.Background(), next, config, "traefik-real-ip")
+			require.NoError(framework, err)
+
+			request := newTestRequest(framework, test.remoteAddr, test.inputHeaders)
+			request.Host = "example.com"
+			request.URL.Path = "/pay"
+			trip.ServeHTTP(httptest.NewRecorder(), request)
+			require.NoError(framework, trip.(*TraefikRealIP).auditSink.Close())
+
+			content, err := os.ReadFile(path)
+			require.NoError(framework, err)
+
+			if test.expectedChanges == nil {
+				assert.Empty(framework, string(content))
+				return
+			}
+
+			var event audit.Event
+			require.NoError(framework, json.Unmarshal(content, &event))
+
+			assert.False(framework, event.Time.IsZero())
+			assert.Equal(framework, "traefik-real-ip", event.Name)
+			assert.Equal(framework, "example.com", event.Host)
+			assert.Equal(framework, "/pay", event.Path)
+			assert.Equal(framework, test.remoteAddr, event.Peer)
+			assert.Equal(framework, test.expectedRealIP, event.IncomingRealIP)
+			assert.Equal(framework, test.expectedIP, event.IP)
+			assert.Equal(framework, test.expectedChanges, event.Changes)
+		})
+	}
+
+	framework.Run("New should return an error if an invalid audit configuration is passed", func(framework *testing.T) {
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+		for _, config := range []*AuditConfig{
+			{Sink: "kafka"},
+			{Sink: "file"},
+			{Sink: "file", Path: filepath.Join(framework.TempDir(), "missing", "audit.log")},
+			{Sink: "syslog", Address: "127.0.0.1:514"},
+		} {
+			_, err := New(context.Background(), next, &Config{Audit: config}, "traefik-real-ip")
+			assert.Error(framework, err, config.Sink)
+		}
+	})
+
+	framework.Run("Middlewares writing to the same file should share the sink", func(framework *testing.T) {
+		config := &Config{Audit: &AuditConfig{Sink: "file", Path: filepath.Join(framework.TempDir(), "audit.log")}}
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+
+		first, err := New(context.Background(), next, config, "first")
+		require.NoError(framework, err)
+		second, err := New(context.Background(), next, config, "second")
+		require.NoError(framework, err)
+
+		sink := first.(*TraefikRealIP).auditSink
+		assert.Same(framework, sink, second.(*TraefikRealIP).auditSink)
+		require.NoError(framework, sink.Close())
+	})
+}
+
+func TestTracing(framework *testing.T) {
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	testCases := []struct {
+		description     string
+		tracing         *TracingConfig
+		trustedNetworks []string
+		inputHeaders    map[string]string
+		expectedError   bool
+		expectedHeaders map[string]string
+	}{
+		{
+			description:   "New should return an error if an invalid trace state key is passed",
+			tracing:       &TracingConfig{TraceState: true, TraceStateKey: "Real.IP"},
+			expectedError: true,
+		},
+		{
+			description:     "Trace context should not be annotated by default",
+			inputHeaders:    map[string]string{"X-Real-Ip": "1.1.1.1", "Traceparent": traceParent, "Baggage": "client.address=8.8.8.8"},
+			expectedHeaders: map[string]string{"Baggage": "client.address=8.8.8.8", "Tracestate": ""},
+		},
+		{
+			description:     "Configured header should be set to the real IP",
+			tracing:         &TracingConfig{Header: "X-Client-Address"},
+			inputHeaders:    map[string]string{"X-Real-Ip": "1.1.1.1", "X-Client-Address": "8.8.8.8"},
+			expectedHeaders: map[string]string{"X-Client-Address": "1.1.1.1"},
+		},
+		{
+			description:     "Configured header sent by the client should be removed when the real IP is unknown",
+			tracing:         &TracingConfig{Header: "X-Client-Address"},
+			inputHeaders:    map[string]string{"X-Real-Ip": "unknown", "X-Client-Address": "8.8.8.8"},
+			expectedHeaders: map[string]string{"X-Client-Address": ""},
+		},
+		{
+			description:     "Baggage should be set to the real IP and provider",
+			tracing:         &TracingConfig{Baggage: true},
+			inputHeaders:    map[string]string{"CF-Connecting-IP": "2001:4860::1"},
+			expectedHeaders: map[string]string{"Baggage": "client.address=2001:4860::1,realip.provider=cloudflare"},
+		},
+		{
+			description:     "Baggage should be set to the peer address of an untrusted peer",
+			tracing:         &TracingConfig{Baggage: true},
+			trustedNetworks: []string{"172.16.0.0/12"},
+			inputHeaders:    map[string]string{"X-Real-Ip": "1.1.1.1"},
+			expectedHeaders: map[string]string{"Baggage": "client.address=10.0.0.1,realip.provider=peer"},
+		},
+		{
+			description: "Baggage members sent by the client should be replaced and other members kept",
+			tracing:     &TracingConfig{Baggage: true},
+			inputHeaders: map[string]string{
+				"X-Real-Ip": "1.1.1.1",
+				"Baggage":   "userId=alice, client.address = 8.8.8.8;source=client, realip.provider=generic",
+			},
+			expectedHeaders: map[string]string{"Baggage": "userId=alice,client.address=1.1.1.1,realip.provider=generic"},
+		},
+		{
+			description:     "Baggage members sent by the client should be removed when the real IP is unknown",
+			tracing:         &TracingConfig{Baggage: true},
+			inputHeaders:    map[string]string{"Baggage": "client.address=8.8.8.8"},
+			expectedHeaders: map[string]string{"Baggage": ""},
+		},
+		{
+			description:     "Trace state should be annotated at the front of the list",
+			tracing:         &TracingConfig{TraceState: true},
+			inputHeaders:    map[string]string{"X-Real-Ip": "1.1.1.1", "Traceparent": traceParent, "Tracestate": "congo=t61rcWkgMzE, realip=8.8.8.8;generic"},
+			expectedHeaders: map[string]string{"Tracestate": "realip=1.1.1.1;generic,congo=t61rcWkgMzE"},
+		},
+		{
+			description:     "Trace state should use the configured key",
+			tracing:         &TracingConfig{TraceState: true, TraceStateKey: "acme/client"},
+			inputHeaders:    map[string]string{"X-Real-Ip": "1.1.1.1", "Traceparent": traceParent},
+			expectedHeaders: map[string]string{"Tracestate": "acme/client=1.1.1.1;generic"},
+		},
+		{
+			description:     "Trace state should not be annotated without a trace parent",
+			tracing:         &TracingConfig{TraceState: true},
+			inputHeaders:    map[string]string{"X-Real-Ip": "1.1.1.1", "Tracestate": "congo=t61rcWkgMzE"},
+			expectedHeaders: map[string]string{"Tracestate": "congo=t61rcWkgMzE"},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			config := &Config{PreferredProvider: "cloudflare", TrustedNetworks: test.trustedNetworks, Tracing: test.tracing}
+			next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+			trip, err := New(context.Background(), next, config, "traefik-real-ip")
+
+			if test.expectedError {
+				assert.Error(framework, err)
+				return
+			}
+			require.NoError(framework, err)
+
+			request := newTestRequest(framework, "10.0.0.1:1234", test.inputHeaders)
+			trip.ServeHTTP(httptest.NewRecorder(), request)
+
+			for header, expected := range test.expectedHeaders {
+				assertHeader(framework, request, header, expected)
+			}
+		})
+	}
+}
+
+func TestMergeTraceStateLimit(framework *testing.T) {
+	members := make([]string, 0, 32)
+	for index := 0; index < 32; index++ {
+		members = append(members, fmt.Sprintf("vendor%d=value", index))
+	}
+
+	merged := mergeTraceState([]string{strings.Join(members, ",")}, "realip", "realip=1.1.1.1;generic")
+
+	require.Len(framework, merged, 32)
+	assert.Equal(framework, "realip=1.1.1.1;generic", merged[0])
+	assert.Equal(framework, "vendor30=value", merged[31])
+}
+
+func TestValidate(framework *testing.T) {
+	framework.Parallel()
+
+	testCases := []struct {
+		description    string
+		config         *Config
+		expectedFields []string
+	}{
+		{
+			description: "Default configuration should be valid",
+			config:      CreateConfig(),
+		},
+		{
+			description: "Named sets and host networks should be valid",
+			config: &Config{
+				ExcludedNetworks: []string{"private", "127.0.0.1/24"},
+				Deny:             []string{"0.0.0.0/0"},
+				Allow:            []string{"::/0"},
+			},
+		},
+		{
+			description: "Overlapping networks should be valid",
+			config: &Config{
+				ExcludedNetworks: []string{"10.1.0.0/16", "10.0.0.0/8"},
+				TrustedNetworks:  []string{"private", "10.0.0.0/8"},
+			},
+		},
+		{
+			description: "Every problem should be reported with its field path",
+			config: &Config{
+				ExcludedNetworks:  []string{"10.0.0.0/8", "invalid", "10.1.0.0/16", "10.0.0.0/8"},
+				ExcludedAddresses: []string{"1.1.1.1", "invalid", "1.1.1.1"},
+				Providers:         []string{"generic", "unknown", "generic"},
+				PreferredProvider: "unknown",
+				StrictStatusCode:  200,
+			},
+			expectedFields: []string{
+				"excludedNetworks[1]",
+				"excludedNetworks[3]",
+				"excludedAddresses[1]",
+				"excludedAddresses[2]",
+				"providers[1]",
+				"providers[2]",
+				"preferredProvider",
+				"strictStatusCode",
+			},
+		},
+		{
+			description: "Provider options should be validated per provider",
+			config: &Config{
+				ProviderOptions: map[string]*ProviderConfig{
+					"unknown": {},
+					"generic": {
+						ExcludedNetworks:  []string{"invalid"},
+						ExcludedAddresses: []string{"invalid"},
+					},
+				},
+			},
+			expectedFields: []string{
+				"providerOptions.generic.excludedNetworks[0]",
+				"providerOptions.generic.excludedAddresses[0]",
+				"providerOptions.unknown",
+			},
+		},
+		{
+			description: "Contradicting access lists should be reported",
+			config: &Config{
+				Allow: []string{"10.0.0.0/8"},
+				Deny:  []string{"10.0.0.0/8"},
+			},
+			expectedFields: []string{"deny[0]"},
+		},
+		{
+			description: "Audit options of another sink should be reported",
+			config: &Config{
+				Audit: &AuditConfig{Sink: "stdout", Path: "/var/log/audit.log", Address: "udp://127.0.0.1:514"},
+			},
+			expectedFields: []string{"audit.path", "audit.address"},
+		},
+		{
+			description: "Sections should be reported under their own name",
+			config: &Config{
+				Cache:    &CacheConfig{MaxEntries: -1},
+				Logging:  &LoggingConfig{Level: "verbose"},
+				Metrics:  &MetricsConfig{Path: "metrics"},
+				Audit:    &AuditConfig{Sink: "file"},
+				Tracing:  &TracingConfig{TraceState: true, TraceStateKey: "Invalid Key"},
+				Limits:   &LimitsConfig{Action: "invalid"},
+				Spoofing: &SpoofingConfig{RealIPMismatch: "invalid"},
+			},
+			expectedFields: []string{
+				"spoofing",
+				"limits",
+				"cache.maxEntries",
+				"logging",
+				"metrics.path",
+				"audit",
+				"tracing",
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			err := test.config.Validate()
+			if len(test.expectedFields) == 0 {
+				require.NoError(framework, err)
+				return
+			}
+
+			var errs ValidationErrors
+			require.ErrorAs(framework, err, &errs)
+
+			fields := make([]string, 0, len(errs))
+			for _, problem := range errs {
+				fields = append(fields, problem.Field)
+			}
+			assert.Equal(framework, test.expectedFields, fields)
+		})
+	}
+}
+
+func TestValidateAggregatesInNew(framework *testing.T) {
+	config := &Config{
+		ExcludedNetworks: []string{"invalid"},
+		Providers:        []string{"unknown"},
+	}
+
+	next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+	_, err := New(context.Background(), next, config, "traefik-real-ip")
+
+	require.Error(framework, err)
+	assert.Contains(framework, err.Error(), "2 problem(s) found")
+	assert.Contains(framework, err.Error(), "excludedNetworks[0]: network invalid is neither in CIDR notation")
+	assert.Contains(framework, err.Error(), "providers[0]: provider unknown is not valid")
+}
+
+func TestLint(framework *testing.T) {
+	framework.Parallel()
+
+	protected := func(config *Config) *Config {
+		if len(config.TrustedNetworks) == 0 {
+			config.TrustedNetworks = []string{"10.0.0.0/8"}
+		}
+		config.Strict = true
+		return config
+	}
+
+	testCases := []struct {
+		description   string
+		config        *Config
+		expectedRules []string
+		expectedField string
+	}{
+		{
+			description:   "Default configuration should warn about untrusted forwarding headers",
+			config:        CreateConfig(),
+			expectedRules: []string{_lintRuleUntrustedForwardedFor},
+			expectedField: "trustedNetworks",
+		},
+		{
+			description:   "Trusted proxies with strict mode should have no warning",
+			config:        protected(CreateConfig()),
+			expectedRules: []string{},
+		},
+		{
+			description:   "Excluding every address should be critical",
+			config:        protected(&Config{ExcludedNetworks: []string{"private", "0.0.0.0/0"}}),
+			expectedRules: []string{_lintRuleExcludesEverything},
+			expectedField: "excludedNetworks[1]",
+		},
+		{
+			description: "Excluding every address for a provider should be critical",
+			config: protected(&Config{ProviderOptions: map[string]*ProviderConfig{
+				"generic": {ExcludedNetworks: []string{"::/0"}},
+			}}),
+			expectedRules: []string{_lintRuleExcludesEverything},
+			expectedField: "providerOptions.generic.excludedNetworks[0]",
+		},
+		{
+			description: "Preferring an unlisted provider should be reported",
+			config: protected(&Config{
+				Providers:         []string{"generic"},
+				PreferredProvider: "cloudflare",
+				TrustedNetworks:   []string{"cloudflare"},
+			}),
+			expectedRules: []string{_lintRulePreferredProviderMissing},
+			expectedField: "preferredProvider",
+		},
+		{
+			description:   "Preferring a provider whose edges are not trusted should be reported",
+			config:        protected(&Config{PreferredProvider: "cloudflare"}),
+			expectedRules: []string{_lintRuleUnverifiedProviderHeader},
+			expectedField: "preferredProvider",
+		},
+		{
+			description:   "Preferring Qrator without trusted networks should be reported",
+			config:        &Config{PreferredProvider: "qrator", Strict: true},
+			expectedRules: []string{_lintRuleUntrustedForwardedFor, _lintRuleUnverifiedProviderHeader},
+		},
+		{
+			description: "Preferring Qrator without trusted networks should be reported despite the spoofing rule",
+			config: &Config{
+				PreferredProvider: "qrator",
+				Strict:            true,
+				Spoofing:          &SpoofingConfig{UntrustedProviderHeader: _spoofingActionBlock},
+			},
+			expectedRules: []string{_lintRuleUntrustedForwardedFor, _lintRuleUnverifiedProviderHeader, _lintRuleUnverifiableSpoofingRule},
+		},
+		{
+			description:   "Untrusted provider header rule without trusted networks should be reported",
+			config:        &Config{Strict: true, Spoofing: &SpoofingConfig{UntrustedProviderHeader: _spoofingActionLog}},
+			expectedRules: []string{_lintRuleUntrustedForwardedFor, _lintRuleUnverifiableSpoofingRule},
+		},
+		{
+			description:   "Untrusted provider header rule with trusted networks should not be reported",
+			config:        protected(&Config{Spoofing: &SpoofingConfig{UntrustedProviderHeader: _spoofingActionLog}}),
+			expectedRules: []string{},
+		},
+		{
+			description:   "Preferring Qrator with trusted networks should not be reported",
+			config:        protected(&Config{PreferredProvider: "qrator"}),
+			expectedRules: []string{},
+		},
+		{
+			description: "Preferring a provider checked by spoofing detection should not be reported",
+			config: protected(&Config{
+				PreferredProvider: "cloudflare",
+				Spoofing:          &SpoofingConfig{UntrustedProviderHeader: "block"},
+			}),
+			expectedRules: []string{},
+		},
+		{
+			description:   "Trusting every peer should be reported",
+			config:        protected(&Config{TrustedNetworks: []string{"0.0.0.0/0"}}),
+			expectedRules: []string{_lintRuleTrustsEverything},
+			expectedField: "trustedNetworks[0]",
+		},
+		{
+			description:   "Trusted networks without strict mode or spoofing detection should not be reported",
+			config:        &Config{TrustedNetworks: []string{"10.0.0.0/8"}},
+			expectedRules: []string{},
+		},
+		{
+			description:   "Rate limiting without trusted proxies should be reported",
+			config:        &Config{RateLimit: &RateLimitConfig{Average: 10}},
+			expectedRules: []string{_lintRuleUntrustedForwardedFor, _lintRuleSpoofableRateLimit},
+		},
+		{
+			description:   "Allowing every address should be reported",
+			config:        protected(&Config{Allow: []string{"private", "::/0"}}),
+			expectedRules: []string{_lintRuleAllowsEverything},
+			expectedField: "allow[1]",
+		},
+		{
+			description:   "Public metrics should be reported",
+			config:        protected(&Config{Metrics: &MetricsConfig{Path: "/metrics", Allow: []string{"0.0.0.0/0"}}}),
+			expectedRules: []string{_lintRulePublicMetrics},
+			expectedField: "metrics.allow[0]",
+		},
+		{
+			description:   "Overlapping networks should be reported",
+			config:        protected(&Config{ExcludedNetworks: []string{"10.1.0.0/16", "10.0.0.0/8"}}),
+			expectedRules: []string{_lintRuleOverlappingNetworks},
+			expectedField: "excludedNetworks[1]",
+		},
+		{
+			description:   "Networks covered by a network set should be reported",
+			config:        protected(&Config{TrustedNetworks: []string{"private", "10.0.0.0/8"}}),
+			expectedRules: []string{_lintRuleOverlappingNetworks},
+			expectedField: "trustedNetworks[1]",
+		},
+		{
+			description: "Overlapping networks of the metrics endpoint should be reported",
+			config: protected(&Config{Metrics: &MetricsConfig{
+				Path:  "/metrics",
+				Allow: []string{"loopback", "127.0.0.1/32"},
+			}}),
+			expectedRules: []string{_lintRuleOverlappingNetworks},
+			expectedField: "metrics.allow[1]",
+		},
+		{
+			description:   "Disjoint networks should not be reported",
+			config:        protected(&Config{Deny: []string{"10.0.0.0/8", "192.168.0.0/16"}}),
+			expectedRules: []string{},
+		},
+		{
+			description:   "Short explain secret should be reported",
+			config:        protected(&Config{Explain: &ExplainConfig{Secret: "secret"}}),
+			expectedRules: []string{_lintRuleWeakExplainSecret},
+			expectedField: "explain.secret",
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			warnings := test.config.Lint()
+
+			rules := make([]string, 0, len(warnings))
+			for _, warning := range warnings {
+				rules = append(rules, warning.Rule)
+				assert.NotEmpty(framework, warning.Message)
+				assert.NotEmpty(framework, warning.Remediation)
+			}
+			assert.Equal(framework, test.expectedRules, rules)
+
+			if test.expectedField != "" {
+				require.NotEmpty(framework, warnings)
+				assert.Equal(framework, test.expectedField, warnings[0].Field)
+			}
+		})
+	}
+}
+
+func TestIsLintSeverityAtLeast(framework *testing.T) {
+	assert.True(framework, IsLintSeverityAtLeast(LintSeverityCritical, LintSeverityWarning))
+	assert.True(framework, IsLintSeverityAtLeast(LintSeverityWarning, LintSeverityWarning))
+	assert.False(framework, IsLintSeverityAtLeast(LintSeverityInfo, LintSeverityWarning))
+}
+
+func TestProvenanceHeaders(framework *testing.T) {
+	testCases := []struct {
+		description      string
+		config           *Config
+		remoteAddr       string
+		inputHeaders     map[string]string
+		expectedProvider string
+		expectedSource   string
+		expectedTrusted  string
+		expectedRealIP   string
+	}{
+		{
+			description: "Provenance headers should not be set when disabled",
+			config:      &Config{},
+			inputHeaders: map[string]string{
+				"X-Forwarded-For": "10.0.0.20",
+			},
+		},
+		{
+			description: "Provenance headers should describe the generic provider",
+			config:      &Config{ProvenanceHeaders: true},
+			inputHeaders: map[string]string{
+				"X-Forwarded-For": "10.0.0.20",
+			},
+			expectedProvider: "generic",
+			expectedSource:   "X-Forwarded-For",
+			expectedTrusted:  "unknown",
+		},
+		{
+			description: "Provenance headers should describe the preferred Cloudflare provider",
+			config:      &Config{ProvenanceHeaders: true, PreferredProvider: "cloudflare"},
+			inputHeaders: map[string]string{
+				"X-Forwarded-For":  "10.0.0.20",
+				"CF-Connecting-IP": "10.0.0.40",
+			},
+			expectedProvider: "cloudflare",
+			expectedSource:   "CF-Connecting-IP",
+			expectedTrusted:  "unknown",
+		},
+		{
+			description: "Provenance headers should mark the peer as untrusted when it is not a trusted network",
+			config:      &Config{ProvenanceHeaders: true, TrustedNetworks: []string{"172.16.0.0/12"}},
+			remoteAddr:  "192.168.1.1:1234",
+			inputHeaders: map[string]string{
+				"X-Real-Ip": "10.0.0.20",
+			},
+			expectedProvider: "peer",
+			expectedTrusted:  "false",
+			expectedRealIP:   "192.168.1.1",
+		},
+		{
+			description: "Provenance headers should mark the result as trusted when the peer is a trusted network",
+			config:      &Config{ProvenanceHeaders: true, TrustedNetworks: []string{"172.16.0.0/12"}},
+			remoteAddr:  "172.16.0.1:1234",
+			inputHeaders: map[string]string{
+				"X-Real-Ip": "10.0.0.20",
+			},
+			expectedProvider: "generic",
+			expectedSource:   "X-Real-Ip",
+			expectedTrusted:  "true",
+		},
+		{
+			description: "Provenance headers sent by the client should be removed",
+			config:      &Config{ProvenanceHeaders: true},
+			inputHeaders: map[string]string{
+				"X-Real-IP-Provider":      "cloudflare",
+				"X-Real-IP-Source-Header": "CF-Connecting-IP",
+				"X-Real-IP-Trusted":       "true",
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+			trip, err := New(context.Background(), next, test.config, "traefik-real-ip")
+			require.NoError(framework, err)
+
+			recorder := httptest.NewRecorder()
+			request := newTestRequest(framework, test.remoteAddr, test.inputHeaders)
+
+			trip.ServeHTTP(recorder, request)
+
+			assertHeader(framework, request, "X-Real-IP-Provider", test.expectedProvider)
+			assertHeader(framework, request, "X-Real-IP-Source-Header", test.expectedSource)
+			assertHeader(framework, request, "X-Real-IP-Trusted", test.expectedTrusted)
+
+			if test.expectedRealIP != "" {
+				assertHeader(framework, request, "X-Real-Ip", test.expectedRealIP)
+				assertHeader(framework, request, "X-Forwarded-For", test.expectedRealIP)
+			}
+		})
+	}
+}
+
+func TestUntrustedPeerWithoutAddress(framework *testing.T) {
+	config := &Config{TrustedNetworks: []string{"172.16.0.0/12"}}
+	next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+	trip, err := New(context.Background(), next, config, "traefik-real-ip")
+	require.NoError(framework, err)
+
+	request := newTestRequest(framework, "invalid", map[string]string{"X-Real-Ip": "1.1.1.1", "X-Forwarded-For": "1.1.1.1"})
+	trip.ServeHTTP(httptest.NewRecorder(), request)
+
+	assertHeader(framework, request, "X-Real-Ip", "")
+	assertHeader(framework, request, "X-Forwarded-For", "")
+}
+
+func TestStrictMode(framework *testing.T) {
+	testCases := []struct {
+		description    string
+		config         *Config
+		remoteAddr     string
+		inputHeaders   map[string]string
+		expectedError  bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			description:   "New should return an error if an invalid strict status code is passed",
+			config:        &Config{Strict: true, StrictStatusCode: 200},
+			expectedError: true,
+		},
+		{
+			description:    "Requests without a real IP should pass through when strict mode is disabled",
+			config:         &Config{},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "Requests without a real IP should be rejected in strict mode",
+			config:         &Config{Strict: true},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Forbidden\n",
+		},
+		{
+			description:    "Requests with a real IP should pass through in strict mode",
+			config:         &Config{Strict: true},
+			inputHeaders:   map[string]string{"X-Real-Ip": "10.0.0.20"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "Requests with malformed headers should be rejected with the configured status and body",
+			config:         &Config{Strict: true, StrictStatusCode: http.StatusBadRequest, StrictBody: "missing client address"},
+			inputHeaders:   map[string]string{"X-Forwarded-For": "invalid, unknown"},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "missing client address\n",
+		},
+		{
+			description:    "Requests with a malformed address in the chain should be rejected in strict mode when the real IP is resolved",
+			config:         &Config{Strict: true},
+			inputHeaders:   map[string]string{"X-Forwarded-For": "unknown, 10.0.0.20"},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Forbidden\n",
+		},
+		{
+			description:    "Requests with a malformed header should be rejected in strict mode when another header resolves",
+			config:         &Config{Strict: true},
+			inputHeaders:   map[string]string{"X-Real-Ip": "garbage", "X-Forwarded-For": "10.0.0.20"},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Forbidden\n",
+		},
+		{
+			description:    "Requests with a malformed preferred provider header should be rejected in strict mode",
+			config:         &Config{Strict: true, PreferredProvider: "cloudflare"},
+			inputHeaders:   map[string]string{"CF-Connecting-IP": "garbage", "X-Forwarded-For": "10.0.0.20"},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Forbidden\n",
+		},
+		{
+			description:    "Requests without headers from an untrusted peer should pass through in strict mode",
+			config:         &Config{Strict: true, TrustedNetworks: []string{"10.0.0.0/8"}},
+			remoteAddr:     "8.8.4.4:1234",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "Requests with provider headers from an untrusted peer should be rejected in strict mode",
+			config:         &Config{Strict: true, TrustedNetworks: []string{"172.16.0.0/12"}},
+			remoteAddr:     "192.168.1.1:1234",
+			inputHeaders:   map[string]string{"X-Real-Ip": "10.0.0.20"},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Forbidden\n",
+		},
+		{
+			description:    "Requests with headers of a provider which is not preferred from an untrusted peer should be rejected in strict mode",
+			config:         &Config{Strict: true, TrustedNetworks: []string{"172.16.0.0/12"}},
+			remoteAddr:     "192.168.1.1:1234",
+			inputHeaders:   map[string]string{"CF-Connecting-IP": "10.0.0.20"},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Forbidden\n",
+		},
+		{
+			description:    "Requests with provider headers from a trusted peer should pass through in strict mode",
+			config:         &Config{Strict: true, TrustedNetworks: []string{"172.16.0.0/12"}},
+			remoteAddr:     "172.16.0.1:1234",
+			inputHeaders:   map[string]string{"X-Real-Ip": "10.0.0.20"},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+			trip, err := New(context.Background(), next, test.config, "traefik-real-ip")
+
+			if test.expectedError {
+				assert.Error(framework, err)
+				return
+			}
+			require.NoError(framework, err)
+
+			recorder := httptest.NewRecorder()
+			request := newTestRequest(framework, test.remoteAddr, test.inputHeaders)
+
+			trip.ServeHTTP(recorder, request)
+
+			assert.Equal(framework, test.expectedStatus, recorder.Code)
+			assert.Equal(framework, test.expectedBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestSpoofingDetection(framework *testing.T) {
+	testCases := []struct {
+		description    string
+		config         *Config
+		remoteAddr     string
+		inputHeaders   map[string]string
+		expectedError  bool
+		expectedStatus int
+		expectedTag    string
+	}{
+		{
+			description:   "New should return an error if an invalid spoofing action is passed",
+			config:        &Config{Spoofing: &SpoofingConfig{RealIPMismatch: "invalid"}},
+			expectedError: true,
+		},
+		{
+			description:    "Cloudflare headers from a non Cloudflare peer should be tagged",
+			config:         &Config{Spoofing: &SpoofingConfig{UntrustedProviderHeader: "tag"}},
+			remoteAddr:     "192.168.1.1:1234",
+			inputHeaders:   map[string]string{"CF-Connecting-IP": "10.0.0.40"},
+			expectedStatus: http.StatusOK,
+			expectedTag:    "untrusted-provider-header",
+		},
+		{
+			description:    "Cloudflare headers from a Cloudflare edge should not be tagged",
+			config:         &Config{Spoofing: &SpoofingConfig{UntrustedProviderHeader: "tag"}},
+			remoteAddr:     "173.245.48.1:1234",
+			inputHeaders:   map[string]string{"CF-Connecting-IP": "10.0.0.40"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "Cloudflare headers from a trusted network should not be tagged",
+			config:         &Config{TrustedNetworks: []string{"192.168.0.0/16"}, Spoofing: &SpoofingConfig{UntrustedProviderHeader: "tag"}},
+			remoteAddr:     "192.168.1.1:1234",
+			inputHeaders:   map[string]string{"CF-Connecting-IP": "10.0.0.40"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "Qrator headers from an untrusted peer should be blocked with the configured status",
+			config:         &Config{TrustedNetworks: []string{"172.16.0.0/12"}, Spoofing: &SpoofingConfig{UntrustedProviderHeader: "block", StatusCode: http.StatusBadRequest}},
+			remoteAddr:     "192.168.1.1:1234",
+			inputHeaders:   map[string]string{"X-Qrator-IP-Source": "10.0.0.30"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			description:    "X-Forwarded-For chains with a private address after a public one should be tagged",
+			config:         &Config{Spoofing: &SpoofingConfig{PrivateAfterPublic: "tag"}},
+			inputHeaders:   map[string]string{"X-Forwarded-For": "8.8.8.8, 10.0.0.20"},
+			expectedStatus: http.StatusOK,
+			expectedTag:    "private-after-public",
+		},
+		{
+			description:    "X-Forwarded-For chains with excluded private addresses should not be tagged",
+			config:         &Config{ExcludedNetworks: []string{"10.0.0.0/8"}, Spoofing: &SpoofingConfig{PrivateAfterPublic: "tag"}},
+			inputHeaders:   map[string]string{"X-Forwarded-For": "8.8.8.8, 10.0.0.20"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "X-Real-Ip disagreeing with X-Forwarded-For should be blocked",
+			config:         &Config{Spoofing: &SpoofingConfig{RealIPMismatch: "block"}},
+			inputHeaders:   map[string]string{"X-Forwarded-For": "8.8.8.8", "X-Real-Ip": "1.1.1.1"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			description:    "X-Real-Ip agreeing with X-Forwarded-For should pass through",
+			config:         &Config{Spoofing: &SpoofingConfig{RealIPMismatch: "block"}},
+			inputHeaders:   map[string]string{"X-Forwarded-For": "8.8.8.8", "X-Real-Ip": "8.8.8.8"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "Spoofing tags sent by the client should be removed",
+			config:         &Config{Spoofing: &SpoofingConfig{RealIPMismatch: "tag"}},
+			inputHeaders:   map[string]string{"X-Real-IP-Spoofing": "none"},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+			trip, err := New(context.Background(), next, test.config, "traefik-real-ip")
+
+			if test.expectedError {
+				assert.Error(framework, err)
+				return
+			}
+			require.NoError(framework, err)
+
+			recorder := httptest.NewRecorder()
+			request := newTestRequest(framework, test.remoteAddr, test.inputHeaders)
+
+			trip.ServeHTTP(recorder, request)
+
+			assert.Equal(framework, test.expectedStatus, recorder.Code)
+			assertHeader(framework, request, "X-Real-IP-Spoofing", test.expectedTag)
+		})
+	}
+}
+
+func TestAccessLists(framework *testing.T) {
+	testCases := []struct {
+		description    string
+		config         *Config
+		remoteAddr     string
+		inputHeaders   map[string]string
+		expectedError  bool
+		expectedStatus int
+	}{
+		{
+			description:   "New should return an error if an invalid allowed network is passed",
+			config:        &Config{Allow: []string{"invalid"}},
+			expectedError: true,
+		},
+		{
+			description:   "New should return an error if an invalid denied network is passed",
+			config:        &Config{Deny: []string{"invalid"}},
+			expectedError: true,
+		},
+		{
+			description:    "Clients from an allowed network should pass through",
+			config:         &Config{Allow: []string{"10.0.0.0/8"}},
+			inputHeaders:   map[string]string{"X-Real-Ip": "10.0.0.20"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "Clients outside of the allowed networks should be rejected",
+			config:         &Config{Allow: []string{"10.0.0.0/8"}},
+			inputHeaders:   map[string]string{"X-Real-Ip": "192.168.1.1"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			description:    "Clients should be evaluated on the real IP instead of the connection peer",
+			config:         &Config{Deny: []string{"10.0.0.0/8"}},
+			remoteAddr:     "10.0.0.1:1234",
+			inputHeaders:   map[string]string{"X-Real-Ip": "192.168.1.1"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "Clients from a denied network should be rejected with the configured status",
+			config:         &Config{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.0/24"}, DeniedStatusCode: http.StatusUnauthorized},
+			inputHeaders:   map[string]string{"X-Real-Ip": "10.0.0.20"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			description:    "IPv6 clients from a denied network should be rejected",
+			config:         &Config{Deny: []string{"2001:4860::/32"}},
+			inputHeaders:   map[string]string{"X-Real-Ip": "2001:4860::1"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			description:    "Connection peer should be evaluated when the real IP could not be determined",
+			config:         &Config{Deny: []string{"192.168.0.0/16"}},
+			remoteAddr:     "192.168.1.1:1234",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		framework.Run(test.description, func(framework *testing.T) {
+			framework.Parallel()
+
+			next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+			trip, err := New(context.Background(), next, test.config, "traefik-real-ip")
+
+			if test.expectedError {
+				assert.Error(framework, err)
+				return
+			}
+			require.NoError(framework, err)
+
+			recorder := httptest.NewRecorder()
+			request := newTestRequest(framework, test.remoteAddr, test.inputHeaders)
+
+			trip.ServeHTTP(recorder, request)
+
+			assert.Equal(framework, test.expectedStatus, recorder.Code)
+		})
+	}
+}
+
+func TestRateLimit(framework *testing.T) {
+	framework.Run("New should return an error if an invalid rate limit period is passed", func(framework *testing.T) {
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+		_, err := New(context.Background(), next, &Config{RateLimit: &RateLimitConfig{Average: 1, Period: "invalid"}}, "traefik-real-ip")
+		assert.Error(framework, err)
+	})
+
+	framework.Run("New should return an error if a negative burst or max entries is passed", func(framework *testing.T) {
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+		_, err := New(context.Background(), next, &Config{RateLimit: &RateLimitConfig{Average: 1, Burst: -1, MaxEntries: -1}}, "traefik-real-ip")
+		assert.ErrorContains(framework, err, "rateLimit: rate limit burst -1 is not valid, it must not be negative")
+
+		_, err = New(context.Background(), next, &Config{RateLimit: &RateLimitConfig{Average: 1, MaxEntries: -1}}, "traefik-real-ip")
+		assert.ErrorContains(framework, err, "rateLimit: rate limit max entries -1 is not valid, it must not be negative")
+	})
+
+	framework.Run("Clients exceeding the rate should be rejected, keyed on the real IP", func(framework *testing.T) {
+		next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {})
+		trip, err := New(context.Background(), next, &Config{RateLimit: &RateLimitConfig{Average: 1, Period: "1m", Burst: 1}}, "traefik-real-ip")
+		require.NoError(framework, err)
+
+		recorder := httptest.NewRecorder()
+		trip.ServeHTTP(recorder, newTestRequest(framework, "10.0.0.1:1234", map[string]string{"X-Real-Ip": "8.8.8.8"}))
+		assert.Equal(framework, http.StatusOK, recorder.Code)
+
+		recorder = httptest.NewRecorder()
+		trip.ServeHTTP(recorder, newTestRequest(framework, "10.0.0.1:1234", map[string]string{"X-Real-Ip": "1.1.1.1"}))
+		assert.Equal(framework, http.StatusOK, recorder.Code)
+
+		recorder = httptest.NewRecorder()
+		trip.ServeHTTP(recorder, newTestRequest(framework, "10.0.0.1:1234", map[string]string{"X-Real-Ip": "8.8.8.8"}))
+		assert.Equal(framework, http.StatusTooManyRequests, recorder.Code)
+		assert.Equal(framework, "60", recorder.Header().Get("Retry-After"))
+	})
+}
+
+// newTestRequest creates a request with the given connection peer and headers.
+func newTestLogger(framework *testing.T, config *LoggingConfig, output *bytes.Buffer) *logger.Logger {
+	framework.Helper()
+
+	logging := CreateLoggingConfig()
+	if config != nil && config.Level != "" {
+		logging.Level = config.Level
+	}
+	if config != nil && config.Format != "" {
+		logging.Format = config.Format
+	}
+	if config != nil && config.Sampling != 0 {
+		logging.Sampling = config.Sampling
+	}
+
+	log, err := logger.New(logger.Options{Level: logging.Level, Format: logging.Format, Output: output, Sampling: logging.Sampling})
+	require.NoError(framework, err)
+
+	return log
+}
+
+func newTestRequest(framework *testing.T, remoteAddr string, headers map[string]string) *http.Request {
+	framework.Helper()
+
+	request, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://localhost", nil)
+	if err != nil {
+		framework.Fatalf("error creating request: %s", err.Error())
+	}
+
+	if remoteAddr != "" {
+		request.RemoteAddr = remoteAddr
+	}
+
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	return request
+}
+
 // assertHeader checks if the given header is present in the response and if it has the expected value.
 func assertHeader(framework *testing.T, request *http.Request, header string, expected string) {
 	framework.Helper()
@@ -0,0 +1,137 @@
+package traefik_real_ip
+
+import (
+	"github.com/darki73/traefik-real-ip/pkg/providers"
+	"net/netip"
+)
+
+// _providerPeer names the connection peer as the provider of the real IP of untrusted peers.
+const _providerPeer = "peer"
+
+const (
+	_strictViolationUnresolved = "unresolved"
+	_strictViolationMalformed  = "malformed"
+	_strictViolationUntrusted  = "untrusted"
+
+	_rejectedLimits           = "limits"
+	_rejectedDuplicateHeaders = "duplicate_headers"
+	_rejectedSpoofing         = "spoofing"
+	_rejectedStrict           = "strict"
+	_rejectedDenied           = "denied"
+	_rejectedRateLimited      = "rate_limited"
+)
+
+// resolution holds the outcome of the real IP determination for a single request.
+type resolution struct {
+	// result is the result of the provider which determined the real IP, nil if none did.
+	result *providers.Result
+	// consulted holds the results of every provider consulted, in order.
+	consulted []*providers.Result
+	// trusted is true if the connection peer is allowed to supply forwarding headers.
+	trusted bool
+	// peer is the address of the connection peer, invalid if it could not be parsed.
+	peer netip.Addr
+}
+
+// isResolved returns true if any of the providers determined the real IP.
+func (res *resolution) isResolved() bool {
+	return res.result != nil
+}
+
+// realIP returns the real IP handed to the next handler: the resolved address, or the peer address if the peer is not trusted.
+// It is invalid if a trusted peer sent no usable forwarding header, or if the address of an untrusted peer could not be parsed.
+func (res *resolution) realIP() netip.Addr {
+	if res.isResolved() {
+		return res.result.IP
+	}
+	if !res.trusted {
+		return res.peer
+	}
+	return netip.Addr{}
+}
+
+// realIPProvider returns the provider of the real IP, peer if it is the address of an untrusted peer.
+func (res *resolution) realIPProvider() string {
+	if res.isResolved() {
+		return res.result.Provider
+	}
+	return _providerPeer
+}
+
+// realIPHeader returns the header the real IP was taken from, empty if it is the address of an untrusted peer.
+func (res *resolution) realIPHeader() string {
+	if res.isResolved() {
+		return res.result.Header
+	}
+	return ""
+}
+
+// consultedResult returns the result of the provider, nil if it was not consulted.
+func (res *resolution) consultedResult(provider string) *providers.Result {
+	for _, result := range res.consulted {
+		if result.Provider == provider {
+			return result
+		}
+	}
+	return nil
+}
+
+// hasProviderHeaders returns true if the request contained headers of any consulted provider.
+func (res *resolution) hasProviderHeaders() bool {
+	for _, result := range res.consulted {
+		if result.HasValues() {
+			return true
+		}
+	}
+	return false
+}
+
+// isMalformed returns true if any consulted provider saw a value which is not an IP address.
+func (res *resolution) isMalformed() bool {
+	for _, result := range res.consulted {
+		if result.IsMalformed() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasExceeded returns true if the headers of any consulted provider exceeded the limits.
+func (res *resolution) hasExceeded() bool {
+	for _, result := range res.consulted {
+		if result.HasExceeded() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDuplicates returns true if any consulted provider saw a duplicated single value header.
+func (res *resolution) hasDuplicates() bool {
+	for _, result := range res.consulted {
+		if result.HasDuplicates() {
+			return true
+		}
+	}
+	return false
+}
+
+// strictViolation returns the reason the resolution is not acceptable in strict mode, or an empty string.
+// Headers of every provider are consulted for untrusted peers, so any of them sent by such a peer is a violation.
+// Malformed values are a violation even when another header resolved, so strict mode never falls back to a header
+// the client controls. Untrusted peers without forwarding headers are acceptable, as their real IP is the peer address.
+func (res *resolution) strictViolation() string {
+	if !res.trusted && res.hasProviderHeaders() {
+		return _strictViolationUntrusted
+	}
+
+	if res.isMalformed() {
+		return _strictViolationMalformed
+	}
+
+	if res.isResolved() || !res.trusted {
+		return ""
+	}
+
+	return _strictViolationUnresolved
+}
@@ -0,0 +1,307 @@
+package traefik_real_ip
+
+import (
+	"fmt"
+	"github.com/darki73/traefik-real-ip/pkg/cidr"
+	"github.com/darki73/traefik-real-ip/pkg/logger"
+	"github.com/darki73/traefik-real-ip/pkg/providers"
+	"github.com/darki73/traefik-real-ip/pkg/resolver"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	_spoofingActionOff   = "off"
+	_spoofingActionLog   = "log"
+	_spoofingActionTag   = "tag"
+	_spoofingActionBlock = "block"
+
+	_spoofingRuleUntrustedProviderHeader = "untrusted-provider-header"
+	_spoofingRulePrivateAfterPublic      = "private-after-public"
+	_spoofingRuleRealIPMismatch          = "real-ip-mismatch"
+
+	_spoofingHeader = "X-Real-IP-Spoofing"
+)
+
+// SpoofingConfig holds the actions taken when a spoofing attempt is detected.
+// Every rule accepts one of the following actions: off, log, tag or block.
+type SpoofingConfig struct {
+	UntrustedProviderHeader string `json:"untrustedProviderHeader,omitempty" toml:"untrustedProviderHeader,omitempty" yaml:"untrustedProviderHeader,omitempty"`
+	PrivateAfterPublic      string `json:"privateAfterPublic,omitempty" toml:"privateAfterPublic,omitempty" yaml:"privateAfterPublic,omitempty"`
+	RealIPMismatch          string `json:"realIpMismatch,omitempty" toml:"realIpMismatch,omitempty" yaml:"realIpMismatch,omitempty"`
+	StatusCode              int    `json:"statusCode,omitempty" toml:"statusCode,omitempty" yaml:"statusCode,omitempty"`
+}
+
+// CreateSpoofingConfig creates the default spoofing configuration, with every rule disabled.
+func CreateSpoofingConfig() *SpoofingConfig {
+	return &SpoofingConfig{
+		UntrustedProviderHeader: _spoofingActionOff,
+		PrivateAfterPublic:      _spoofingActionOff,
+		RealIPMismatch:          _spoofingActionOff,
+		StatusCode:              http.StatusForbidden,
+	}
+}
+
+// newSpoofingConfig validates the spoofing configuration and fills in the defaults.
+func newSpoofingConfig(config *SpoofingConfig) (*SpoofingConfig, error) {
+	spoofing := CreateSpoofingConfig()
+
+	if config == nil {
+		return spoofing, nil
+	}
+
+	rules := map[string]*string{
+		_spoofingRuleUntrustedProviderHeader: &spoofing.UntrustedProviderHeader,
+		_spoofingRulePrivateAfterPublic:      &spoofing.PrivateAfterPublic,
+		_spoofingRuleRealIPMismatch:          &spoofing.RealIPMismatch,
+	}
+	actions := map[string]string{
+		_spoofingRuleUntrustedProviderHeader: config.UntrustedProviderHeader,
+		_spoofingRulePrivateAfterPublic:      config.PrivateAfterPublic,
+		_spoofingRuleRealIPMismatch:          config.RealIPMismatch,
+	}
+
+	for rule, action := range actions {
+		if action == "" {
+			continue
+		}
+		if !isValidSpoofingAction(action) {
+			return nil, fmt.Errorf(
+				"spoofing action %s for rule %s is not valid, only the following ones are supported: %s",
+				action,
+				rule,
+				strings.Join([]string{_spoofingActionOff, _spoofingActionLog, _spoofingActionTag, _spoofingActionBlock}, ", "),
+			)
+		}
+		*rules[rule] = action
+	}
+
+	if config.StatusCode != 0 {
+		if config.StatusCode < 400 || config.StatusCode > 599 {
+			return nil, fmt.Errorf("spoofing status code %d is not valid, only 4xx and 5xx codes are supported", config.StatusCode)
+		}
+		spoofing.StatusCode = config.StatusCode
+	}
+
+	return spoofing, nil
+}
+
+// isValidSpoofingAction returns true if the action is supported.
+func isValidSpoofingAction(action string) bool {
+	switch action {
+	case _spoofingActionOff, _spoofingActionLog, _spoofingActionTag, _spoofingActionBlock:
+		return true
+	}
+	return false
+}
+
+// spoofingViolation describes a spoofing rule violated by the request.
+type spoofingViolation struct {
+	rule   string
+	action string
+}
+
+// edgeProvider is a provider whose headers are only expected from its own edge servers.
+type edgeProvider interface {
+	GetName() string
+	GetHeaders() []string
+	GetEdgeNetworks() *cidr.Matcher
+}
+
+// handleSpoofing detects spoofing attempts in the resolution of the request and applies the configured actions.
+// It returns false if the request was blocked and must not be passed to the next handler.
+func (trip *TraefikRealIP) handleSpoofing(responseWriter http.ResponseWriter, request *http.Request, res *resolution) bool {
+	var tags []string
+	blocked := false
+
+	for _, violation := range trip.detectSpoofing(request, res) {
+		trip.metrics.observeSpoofing(violation.rule)
+
+		switch violation.action {
+		case _spoofingActionLog:
+			trip.logger.Log(
+				logger.LevelWarn,
+				"spoofing suspected",
+				logger.Field{Key: "name", Value: trip.name},
+				logger.Field{Key: "rule", Value: violation.rule},
+				logger.Field{Key: "peer", Value: request.RemoteAddr},
+			)
+		case _spoofingActionTag:
+			tags = append(tags, violation.rule)
+		case _spoofingActionBlock:
+			blocked = true
+		}
+	}
+
+	if blocked {
+		http.Error(responseWriter, http.StatusText(trip.spoofing.StatusCode), trip.spoofing.StatusCode)
+		return false
+	}
+
+	if trip.hasSpoofingAction(_spoofingActionTag) {
+		trip.mutex.Lock()
+		request.Header.Del(_spoofingHeader)
+		if len(tags) > 0 {
+			request.Header.Set(_spoofingHeader, strings.Join(tags, ", "))
+		}
+		trip.mutex.Unlock()
+	}
+
+	return true
+}
+
+// hasSpoofingAction returns true if any of the spoofing rules uses the action.
+func (trip *TraefikRealIP) hasSpoofingAction(action string) bool {
+	return trip.spoofing.UntrustedProviderHeader == action ||
+		trip.spoofing.PrivateAfterPublic == action ||
+		trip.spoofing.RealIPMismatch == action
+}
+
+// detectSpoofing returns the enabled spoofing rules violated by the request.
+// Rules are evaluated against the header values seen by the consulted providers, so headers are not read again.
+func (trip *TraefikRealIP) detectSpoofing(request *http.Request, res *resolution) []spoofingViolation {
+	var violations []spoofingViolation
+
+	if action := trip.spoofing.UntrustedProviderHeader; action != _spoofingActionOff {
+		if trip.hasUntrustedProviderHeader(request, res) {
+			violations = append(violations, spoofingViolation{rule: _spoofingRuleUntrustedProviderHeader, action: action})
+		}
+	}
+
+	if action := trip.spoofing.PrivateAfterPublic; action != _spoofingActionOff {
+		if trip.hasPrivateAfterPublic(res) {
+			violations = append(violations, spoofingViolation{rule: _spoofingRulePrivateAfterPublic, action: action})
+		}
+	}
+
+	if action := trip.spoofing.RealIPMismatch; action != _spoofingActionOff {
+		if trip.hasRealIPMismatch(res) {
+			violations = append(violations, spoofingViolation{rule: _spoofingRuleRealIPMismatch, action: action})
+		}
+	}
+
+	return violations
+}
+
+// hasUntrustedProviderHeader returns true if a CDN provider header was sent by a peer which is not an edge of that provider.
+func (trip *TraefikRealIP) hasUntrustedProviderHeader(request *http.Request, res *resolution) bool {
+	edgeProviders := []edgeProvider{trip.resolver.Cloudflare(), trip.resolver.Qrator()}
+
+	peer := resolver.ParsePeerIP(request.RemoteAddr)
+
+	for _, provider := range edgeProviders {
+		if !hasProviderHeaders(request, res, provider) {
+			continue
+		}
+		if !trip.isProviderPeer(peer, provider.GetEdgeNetworks()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasProviderHeaders returns true if the request contained any of the provider headers.
+// Headers of providers which were not consulted were never parsed, so only their presence is checked.
+func hasProviderHeaders(request *http.Request, res *resolution, provider edgeProvider) bool {
+	if result := res.consultedResult(provider.GetName()); result != nil {
+		return result.HasValues()
+	}
+
+	for _, header := range provider.GetHeaders() {
+		if request.Header.Get(header) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isProviderPeer returns true if the peer is either a trusted network or one of the provider edge networks.
+// Providers which do not publish their edge networks are only verified against the trusted networks,
+// so without any every peer passes, which Lint reports as unverifiable-spoofing-rule.
+func (trip *TraefikRealIP) isProviderPeer(peer netip.Addr, edgeNetworks *cidr.Matcher) bool {
+	if !peer.IsValid() {
+		return false
+	}
+
+	if trip.GetTrustedNetworks().Contains(peer) {
+		return true
+	}
+
+	if edgeNetworks.Len() > 0 {
+		return edgeNetworks.Contains(peer)
+	}
+
+	return trip.GetTrustedNetworks().Len() == 0
+}
+
+// hasPrivateAfterPublic returns true if the X-Forwarded-For chain contains a private address after a public one.
+// Addresses from excluded and trusted networks are known proxies and are skipped.
+func (trip *TraefikRealIP) hasPrivateAfterPublic(res *resolution) bool {
+	generic := res.consultedResult(resolver.ProviderGeneric)
+	if generic == nil {
+		return false
+	}
+
+	value, ok := generic.Values["X-Forwarded-For"]
+	if !ok {
+		return false
+	}
+
+	seenPublic := false
+
+	for _, address := range providers.SplitForwardedFor(value) {
+		candidate, err := providers.ParseAddress(address)
+		if err != nil {
+			continue
+		}
+		ip := candidate.Addr()
+		if trip.GetProviderExclusions("generic").Contains(ip) || trip.GetTrustedNetworks().Contains(ip) {
+			continue
+		}
+
+		if isPrivateIP(ip) {
+			if seenPublic {
+				return true
+			}
+		} else {
+			seenPublic = true
+		}
+	}
+
+	return false
+}
+
+// hasRealIPMismatch returns true if the X-Real-Ip header disagrees with the address derived from X-Forwarded-For.
+func (trip *TraefikRealIP) hasRealIPMismatch(res *resolution) bool {
+	generic := res.consultedResult(resolver.ProviderGeneric)
+	if generic == nil {
+		return false
+	}
+
+	realIP, ok := generic.Values["X-Real-Ip"]
+	if !ok {
+		return false
+	}
+
+	forwardedFor, ok := generic.Values["X-Forwarded-For"]
+	if !ok {
+		return false
+	}
+
+	forwardedIP := trip.resolver.Generic().GetForwardedForIP(forwardedFor)
+	if !forwardedIP.IsValid() {
+		return false
+	}
+
+	address, _ := providers.ParseAddress(realIP)
+
+	return address.Addr() != forwardedIP
+}
+
+// isPrivateIP returns true if the IP address is private, loopback or link-local.
+func isPrivateIP(ip netip.Addr) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()
+}
@@ -0,0 +1,185 @@
+package traefik_real_ip
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	_traceParentHeader = "Traceparent"
+	_traceStateHeader  = "Tracestate"
+	_baggageHeader     = "Baggage"
+
+	_baggageClientAddress = "client.address"
+	_baggageProvider      = "realip.provider"
+
+	// _traceStateMaxMembers is the maximum number of tracestate list members, as defined by W3C Trace Context.
+	_traceStateMaxMembers = 32
+)
+
+// TracingConfig holds the configuration of the trace context annotation with the real IP.
+// Values sent by the client for the configured keys are always removed, so they can not be spoofed.
+type TracingConfig struct {
+	Baggage       bool   `json:"baggage,omitempty" toml:"baggage,omitempty" yaml:"baggage,omitempty"`
+	TraceState    bool   `json:"traceState,omitempty" toml:"traceState,omitempty" yaml:"traceState,omitempty"`
+	TraceStateKey string `json:"traceStateKey,omitempty" toml:"traceStateKey,omitempty" yaml:"traceStateKey,omitempty"`
+	Header        string `json:"header,omitempty" toml:"header,omitempty" yaml:"header,omitempty"`
+}
+
+// CreateTracingConfig creates the default tracing configuration, with every annotation disabled.
+func CreateTracingConfig() *TracingConfig {
+	return &TracingConfig{
+		Baggage:       false,
+		TraceState:    false,
+		TraceStateKey: "realip",
+		Header:        "",
+	}
+}
+
+// newTracingConfig validates the tracing configuration and fills in the defaults.
+func newTracingConfig(config *TracingConfig) (*TracingConfig, error) {
+	tracing := CreateTracingConfig()
+
+	if config == nil {
+		return tracing, nil
+	}
+
+	tracing.Baggage = config.Baggage
+	tracing.TraceState = config.TraceState
+	tracing.Header = config.Header
+
+	if config.TraceStateKey != "" {
+		if !isValidTraceStateKey(config.TraceStateKey) {
+			return nil, fmt.Errorf(
+				"trace state key %s is not valid, it must start with a lowercase letter and only contain lowercase letters, digits, _, -, * and /",
+				config.TraceStateKey,
+			)
+		}
+		tracing.TraceStateKey = config.TraceStateKey
+	}
+
+	return tracing, nil
+}
+
+// isEnabled returns true if any annotation is enabled.
+func (tracing *TracingConfig) isEnabled() bool {
+	return tracing.Baggage || tracing.TraceState || tracing.Header != ""
+}
+
+// setTraceContext annotates the trace context headers with the real IP and the provider which determined it.
+func (trip *TraefikRealIP) setTraceContext(request *http.Request, res *resolution) {
+	tracing := trip.tracing
+
+	var ip, provider string
+	if realIP := res.realIP(); realIP.IsValid() {
+		ip = realIP.String()
+		provider = res.realIPProvider()
+	}
+
+	trip.mutex.Lock()
+	defer trip.mutex.Unlock()
+
+	if tracing.Header != "" {
+		request.Header.Del(tracing.Header)
+		if ip != "" {
+			request.Header.Set(tracing.Header, ip)
+		}
+	}
+
+	if tracing.Baggage {
+		var members []string
+		if ip != "" {
+			members = []string{_baggageClientAddress + "=" + ip, _baggageProvider + "=" + provider}
+		}
+		setListHeader(request.Header, _baggageHeader, mergeBaggage(request.Header.Values(_baggageHeader), members))
+	}
+
+	if tracing.TraceState && request.Header.Get(_traceParentHeader) != "" {
+		var member string
+		if ip != "" {
+			member = tracing.TraceStateKey + "=" + ip + ";" + provider
+		}
+		setListHeader(request.Header, _traceStateHeader, mergeTraceState(request.Header.Values(_traceStateHeader), tracing.TraceStateKey, member))
+	}
+}
+
+// mergeBaggage returns the baggage without the members set by the plugin, followed by the new members.
+func mergeBaggage(lines []string, members []string) []string {
+	merged := make([]string, 0, len(members)+1)
+
+	for _, member := range splitList(lines) {
+		key, _, _ := strings.Cut(member, "=")
+		key = strings.TrimSpace(key)
+		if key == _baggageClientAddress || key == _baggageProvider {
+			continue
+		}
+		merged = append(merged, member)
+	}
+
+	return append(merged, members...)
+}
+
+// mergeTraceState returns the trace state with the member of the key moved to the front, as required for
+// updated members by W3C Trace Context. The oldest members are dropped if the list would grow too long.
+func mergeTraceState(lines []string, key string, member string) []string {
+	merged := make([]string, 0, _traceStateMaxMembers)
+	if member != "" {
+		merged = append(merged, member)
+	}
+
+	for _, existing := range splitList(lines) {
+		existingKey, _, _ := strings.Cut(existing, "=")
+		if strings.TrimSpace(existingKey) == key {
+			continue
+		}
+		if len(merged) == _traceStateMaxMembers {
+			break
+		}
+		merged = append(merged, existing)
+	}
+
+	return merged
+}
+
+// splitList returns the non-empty members of the comma separated list header lines.
+func splitList(lines []string) []string {
+	var members []string
+
+	for _, line := range lines {
+		for _, member := range strings.Split(line, ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				members = append(members, member)
+			}
+		}
+	}
+
+	return members
+}
+
+// setListHeader sets the header to the comma separated members, or removes it if there are none.
+func setListHeader(header http.Header, key string, members []string) {
+	if len(members) == 0 {
+		header.Del(key)
+		return
+	}
+
+	header.Set(key, strings.Join(members, ","))
+}
+
+// isValidTraceStateKey returns true if the key is a valid simple key of a tracestate list member.
+func isValidTraceStateKey(key string) bool {
+	if len(key) > 256 || key[0] < 'a' || key[0] > 'z' {
+		return false
+	}
+
+	for _, char := range key {
+		switch {
+		case char >= 'a' && char <= 'z', char >= '0' && char <= '9', char == '_', char == '-', char == '*', char == '/':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
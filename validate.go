@@ -0,0 +1,257 @@
+package traefik_real_ip
+
+import (
+	"fmt"
+	"github.com/darki73/traefik-real-ip/pkg/networks"
+	"github.com/darki73/traefik-real-ip/pkg/providers"
+	"github.com/darki73/traefik-real-ip/pkg/resolver"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// _availableProviders holds the names of the supported providers.
+var _availableProviders = resolver.Providers()
+
+// ValidationError describes a problem with a single option of the configuration.
+type ValidationError struct {
+	// Field is the path of the option, such as excludedNetworks[2] or providerOptions.generic.excludedAddresses[0].
+	Field string `json:"field"`
+	// Message describes the problem.
+	Message string `json:"message"`
+}
+
+// Error returns the path of the option followed by the problem.
+func (err ValidationError) Error() string {
+	return err.Field + ": " + err.Message
+}
+
+// ValidationErrors holds every problem found in the configuration, in the order of the options.
+type ValidationErrors []ValidationError
+
+// Error returns every problem, one per line.
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, 0, len(errs)+1)
+	lines = append(lines, fmt.Sprintf("configuration is not valid, %d problem(s) found:", len(errs)))
+	for _, err := range errs {
+		lines = append(lines, "  - "+err.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// validator collects the problems of the configuration.
+type validator struct {
+	errors ValidationErrors
+}
+
+// add records the problem of the field.
+func (v *validator) add(field string, format string, arguments ...interface{}) {
+	v.errors = append(v.errors, ValidationError{Field: field, Message: fmt.Sprintf(format, arguments...)})
+}
+
+// check records the error of the field, if any.
+func (v *validator) check(field string, err error) {
+	if err != nil {
+		v.add(field, "%s", err.Error())
+	}
+}
+
+// Validate checks the whole configuration and returns every problem found as ValidationErrors,
+// or nil if the configuration is valid. Unlike New, it does not stop at the first problem.
+func (config *Config) Validate() error {
+	v := &validator{}
+
+	v.networks("excludedNetworks", config.ExcludedNetworks)
+	v.addresses("excludedAddresses", config.ExcludedAddresses)
+	v.providers("providers", config.Providers)
+	v.providerOptions(config)
+
+	if config.PreferredProvider != "" && !isAvailableProvider(config.PreferredProvider) {
+		v.add("preferredProvider", "provider %s is not valid, only the following ones are supported: %s",
+			config.PreferredProvider, strings.Join(_availableProviders, ", "))
+	}
+
+	v.networks("trustedNetworks", config.TrustedNetworks)
+	v.statusCode("strictStatusCode", config.StrictStatusCode)
+
+	_, err := newSpoofingConfig(config.Spoofing)
+	v.check("spoofing", err)
+
+	v.networks("allow", config.Allow)
+	v.networks("deny", config.Deny)
+	v.contradictingNetworks(config.Allow, config.Deny)
+	v.statusCode("deniedStatusCode", config.DeniedStatusCode)
+
+	_, err = newRateLimitConfig(config.RateLimit)
+	v.check("rateLimit", err)
+
+	_, err = newLimitsConfig(config.Limits)
+	v.check("limits", err)
+
+	_, err = newDuplicateHeadersConfig(config.DuplicateHeaders)
+	v.check("duplicateHeaders", err)
+
+	if config.Cache != nil && config.Cache.MaxEntries < 0 {
+		v.add("cache.maxEntries", "max entries %d is not valid, it must not be negative", config.Cache.MaxEntries)
+	}
+
+	if config.LogLevel != "" {
+		_, err = newLogger(&LoggingConfig{Level: config.LogLevel})
+		v.check("logLevel", err)
+	}
+
+	_, err = newLogger(config.Logging)
+	v.check("logging", err)
+
+	if config.Metrics != nil && config.Metrics.Path != "" {
+		if !strings.HasPrefix(config.Metrics.Path, "/") {
+			v.add("metrics.path", "path %s is not valid, it must start with /", config.Metrics.Path)
+		}
+		v.networks("metrics.allow", config.Metrics.Allow)
+	}
+
+	v.check("audit", checkAuditConfig(config.Audit))
+	if config.Audit != nil {
+		if config.Audit.Path != "" && config.Audit.Sink != _auditSinkFile {
+			v.add("audit.path", "path is only used by the %s sink, the configured sink is %q", _auditSinkFile, config.Audit.Sink)
+		}
+		if config.Audit.Address != "" && config.Audit.Sink != _auditSinkSyslog {
+			v.add("audit.address", "address is only used by the %s sink, the configured sink is %q", _auditSinkSyslog, config.Audit.Sink)
+		}
+	}
+
+	_, err = newTracingConfig(config.Tracing)
+	v.check("tracing", err)
+
+	if len(v.errors) == 0 {
+		return nil
+	}
+
+	return v.errors
+}
+
+// networks checks that every value is a network in CIDR notation or a built-in network set,
+// and that no value repeats. Overlapping networks are valid and left to Lint.
+func (v *validator) networks(field string, values []string) {
+	seen := make(map[string]int, len(values))
+
+	for index, value := range values {
+		path := fmt.Sprintf("%s[%d]", field, index)
+
+		if previous, ok := seen[value]; ok {
+			v.add(path, "network %s is already listed at %s[%d]", value, field, previous)
+			continue
+		}
+		seen[value] = index
+
+		if networks.IsNamedSet(value) {
+			continue
+		}
+
+		if _, err := netip.ParsePrefix(value); err != nil {
+			v.add(path, "network %s is neither in CIDR notation nor one of the following sets: %s",
+				value, strings.Join(networks.Names(), ", "))
+		}
+	}
+}
+
+// addresses checks that every value is an IP address and that no address repeats.
+func (v *validator) addresses(field string, values []string) {
+	seen := make(map[netip.Addr]int, len(values))
+
+	for index, value := range values {
+		path := fmt.Sprintf("%s[%d]", field, index)
+
+		address, err := providers.ParseAddress(value)
+		if err != nil {
+			v.add(path, "address %s is not valid: %s", value, err.Error())
+			continue
+		}
+
+		if previous, ok := seen[address.Addr()]; ok {
+			v.add(path, "address %s is already listed at %s[%d]", value, field, previous)
+			continue
+		}
+		seen[address.Addr()] = index
+	}
+}
+
+// providers checks that every value is a supported provider and that no provider repeats.
+func (v *validator) providers(field string, values []string) {
+	seen := make(map[string]int, len(values))
+
+	for index, value := range values {
+		path := fmt.Sprintf("%s[%d]", field, index)
+
+		if !isAvailableProvider(value) {
+			v.add(path, "provider %s is not valid, only the following ones are supported: %s",
+				value, strings.Join(_availableProviders, ", "))
+			continue
+		}
+
+		if previous, ok := seen[value]; ok {
+			v.add(path, "provider %s is already listed at %s[%d]", value, field, previous)
+			continue
+		}
+		seen[value] = index
+	}
+}
+
+// providerOptions checks the options of every provider, in the order of the provider names.
+func (v *validator) providerOptions(config *Config) {
+	names := make([]string, 0, len(config.ProviderOptions))
+	for name := range config.ProviderOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := "providerOptions." + name
+
+		if !isAvailableProvider(name) {
+			v.add(field, "provider %s is not valid, only the following ones are supported: %s",
+				name, strings.Join(_availableProviders, ", "))
+			continue
+		}
+
+		options := config.ProviderOptions[name]
+		if options == nil {
+			continue
+		}
+
+		v.networks(field+".excludedNetworks", options.ExcludedNetworks)
+		v.addresses(field+".excludedAddresses", options.ExcludedAddresses)
+	}
+}
+
+// contradictingNetworks checks that no network is both allowed and denied.
+func (v *validator) contradictingNetworks(allow []string, deny []string) {
+	allowed := make(map[string]int, len(allow))
+	for index, value := range allow {
+		allowed[value] = index
+	}
+
+	for index, value := range deny {
+		if other, ok := allowed[value]; ok {
+			v.add(fmt.Sprintf("deny[%d]", index), "network %s is also allowed at allow[%d], deny takes precedence", value, other)
+		}
+	}
+}
+
+// statusCode checks that a set status code is a 4xx or 5xx code.
+func (v *validator) statusCode(field string, code int) {
+	if code != 0 && (code < 400 || code > 599) {
+		v.add(field, "status code %d is not valid, only 4xx and 5xx codes are supported", code)
+	}
+}
+
+// isAvailableProvider returns true if the provider is supported.
+func isAvailableProvider(provider string) bool {
+	for _, available := range _availableProviders {
+		if available == provider {
+			return true
+		}
+	}
+	return false
+}